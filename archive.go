@@ -0,0 +1,682 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uiez/tash/syntax"
+)
+
+const (
+	archiveTar    = "tar"
+	archiveTarGz  = "tar.gz"
+	archiveTarBz2 = "tar.bz2"
+	archiveZip    = "zip"
+)
+
+// SOURCE_DATE_EPOCH is the timestamp of all archive entries if defined, see https://reproducible-builds.org/specs/source-date-epoch/
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// archiveEpoch is the default timestamp of archive entries, it's the minimum time of zip.
+var archiveEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveFormat resolves archive format, it's detected by file extension if format is empty.
+func archiveFormat(format, file string) (string, error) {
+	switch strings.ToLower(format) {
+	case "":
+		name := strings.ToLower(file)
+		switch {
+		case strings.HasSuffix(name, ".tar"):
+			return archiveTar, nil
+		case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+			return archiveTarGz, nil
+		case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+			return archiveTarBz2, nil
+		case strings.HasSuffix(name, ".zip"):
+			return archiveZip, nil
+		}
+		return "", fmt.Errorf("couldn't detect archive format of file: %s", file)
+	case archiveTar:
+		return archiveTar, nil
+	case archiveTarGz, "tgz":
+		return archiveTarGz, nil
+	case archiveTarBz2, "tbz2":
+		return archiveTarBz2, nil
+	case archiveZip:
+		return archiveZip, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+type archiveEntry struct {
+	// slash separated entry name, directory ends with '/'
+	name string
+	path string
+	info os.FileInfo
+}
+
+// archiveEntryName converts matched path to entry name, it couldn't be outside of working directory.
+func archiveEntryName(p string) (string, error) {
+	name := filepath.ToSlash(filepath.Clean(p))
+	name = strings.TrimPrefix(name, filepath.VolumeName(p))
+	name = strings.TrimLeft(name, "/")
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("path is outside of working directory: %s", p)
+	}
+	if name == "" {
+		name = "."
+	}
+	return name, nil
+}
+
+// collectArchiveEntries walks matched paths recursively, entries are sorted by name and deduplicated.
+// symlinks are kept, exclude patterns are matched with entry names without prefix, dest file is skipped.
+func collectArchiveEntries(paths []string, prefix string, exclude []string, dest string) ([]archiveEntry, error) {
+	destAbs, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	filter := copyOptions{exclude: exclude}
+	entries := make(map[string]archiveEntry)
+	for _, p := range paths {
+		base, err := archiveEntryName(p)
+		if err != nil {
+			return nil, err
+		}
+		err = walkSource(p, copyOptions{preserveSymlinks: true}, func(relPath, srcPath string, info os.FileInfo) error {
+			name := path.Join(base, relPath)
+			if abs, err := filepath.Abs(srcPath); err == nil && abs == destAbs {
+				return nil
+			}
+			if name != "." {
+				skip, err := filter.skipped(name, info.IsDir())
+				if err != nil {
+					return err
+				}
+				if skip {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			name = path.Join(prefix, name)
+			if name == "." {
+				return nil
+			}
+			if info.IsDir() {
+				name += "/"
+			}
+			entries[name] = archiveEntry{name: name, path: srcPath, info: info}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	list := make([]archiveEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list, nil
+}
+
+// archiveTime returns timestamp of entries from SOURCE_DATE_EPOCH, or the default archive epoch.
+func archiveTime(envs *ExpandEnvs) (time.Time, error) {
+	s, has := envs.get(sourceDateEpochEnv)
+	if !has || s == "" {
+		return archiveEpoch, nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %s", sourceDateEpochEnv, s)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// createArchive writes reproducible archive: entries are sorted, timestamps are normalized,
+// owners are dropped and only permission bits are kept.
+func createArchive(envs *ExpandEnvs, action syntax.ActionArchive, paths []string) (int, error) {
+	format, err := archiveFormat(action.Format, action.Dest)
+	if err != nil {
+		return 0, err
+	}
+	if format == archiveTarBz2 {
+		return 0, fmt.Errorf("creating %s archive is not supported", format)
+	}
+	mtime, err := archiveTime(envs)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := collectArchiveEntries(paths, action.Prefix, action.Exclude, action.Dest)
+	if err != nil {
+		return 0, fmt.Errorf("collect archive entries failed: %w", err)
+	}
+
+	// archive is written to temporary file and renamed, existing dest is kept on failure
+	err = writeFileAtomic(action.Dest, 0, func(w io.Writer) error {
+		switch format {
+		case archiveZip:
+			return writeZipArchive(w, entries, mtime)
+		case archiveTarGz:
+			gw := gzip.NewWriter(w)
+			err := writeTarArchive(gw, entries, mtime)
+			if err == nil {
+				err = gw.Close()
+			}
+			return err
+		default:
+			return writeTarArchive(w, entries, mtime)
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("write archive failed: %w", err)
+	}
+	return len(entries), nil
+}
+
+func writeTarArchive(w io.Writer, entries []archiveEntry, mtime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		mode := e.info.Mode()
+		hdr := tar.Header{
+			Name:    e.name,
+			Mode:    int64(mode.Perm()),
+			ModTime: mtime,
+		}
+		switch {
+		case mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = filepath.ToSlash(target)
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = e.info.Size()
+		}
+		err := tw.WriteHeader(&hdr)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			err = copyFileTo(tw, e.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeZipArchive(w io.Writer, entries []archiveEntry, mtime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		mode := e.info.Mode()
+		hdr := zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Deflate,
+			Modified: mtime,
+		}
+		hdr.SetMode(mode&(os.ModeDir|os.ModeSymlink) | mode.Perm())
+		if mode.IsDir() {
+			hdr.Method = zip.Store
+		}
+		fw, err := zw.CreateHeader(&hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode.IsDir():
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, filepath.ToSlash(target))
+			if err != nil {
+				return err
+			}
+		default:
+			err = copyFileTo(fw, e.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = io.Copy(w, fd)
+	return err
+}
+
+// extractOptions controls archive extracting.
+type extractOptions struct {
+	format string
+	// number of leading path components removed from entry names
+	stripComponents int
+	// patterns of extracted entries, all entries are extracted if empty, see matchPathPattern
+	include []string
+}
+
+type extractedDir struct {
+	path  string
+	mode  os.FileMode
+	mtime time.Time
+}
+
+// archiveExtractor writes entries into dest directory, entries couldn't escape dest directory,
+// by their names, symlink targets or existing symlinks in dest directory.
+type archiveExtractor struct {
+	dest string
+	opts extractOptions
+	dirs []extractedDir
+}
+
+// entryPath cleans entry name and strips leading components, empty if entry is skipped.
+func (e *archiveExtractor) entryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("absolute entry path is not allowed: %s", name)
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("entry path is outside of dest directory: %s", name)
+	}
+	if name == "." {
+		return "", nil
+	}
+	secs := strings.Split(name, "/")
+	if len(secs) <= e.opts.stripComponents {
+		return "", nil
+	}
+	return strings.Join(secs[e.opts.stripComponents:], "/"), nil
+}
+
+func (e *archiveExtractor) included(name string, isDir bool) (bool, error) {
+	if len(e.opts.include) == 0 {
+		return true, nil
+	}
+	if isDir {
+		return false, nil
+	}
+	for _, p := range e.opts.include {
+		ok, err := matchPathPattern(p, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid include pattern: %s, %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// prepare checks that parent directories of entry in dest directory are not symlinks, creates them
+// and removes existing file, it returns the target file path.
+func (e *archiveExtractor) prepare(name string, isDir bool) (string, error) {
+	secs := strings.Split(name, "/")
+	dir := e.dest
+	for _, sec := range secs[:len(secs)-1] {
+		dir = filepath.Join(dir, sec)
+		stat, err := os.Lstat(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			err = os.Mkdir(dir, 0755)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		if !stat.IsDir() {
+			return "", fmt.Errorf("entry path traverses non-directory: %s", name)
+		}
+	}
+	target := filepath.Join(dir, secs[len(secs)-1])
+	stat, err := os.Lstat(target)
+	if err == nil {
+		if stat.IsDir() {
+			if isDir {
+				return target, nil
+			}
+			return "", fmt.Errorf("entry conflicts with existing directory: %s", name)
+		}
+		err = os.Remove(target)
+		if err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+func (e *archiveExtractor) extractDir(name string, mode os.FileMode, mtime time.Time) error {
+	target, err := e.prepare(name, true)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(target, 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	e.dirs = append(e.dirs, extractedDir{path: target, mode: mode, mtime: mtime})
+	return nil
+}
+
+func (e *archiveExtractor) extractFile(name string, mode os.FileMode, mtime time.Time, r io.Reader) error {
+	target, err := e.prepare(name, false)
+	if err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, r)
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(target, mode)
+	}
+	if err == nil {
+		err = os.Chtimes(target, mtime, mtime)
+	}
+	return err
+}
+
+// maxSymlinkHops limits symlinks followed in resolving one path, to detect symlink cycles.
+const maxSymlinkHops = 255
+
+// resolve resolves slash separated path relative to dest directory on the real filesystem, symlinks
+// are followed and the path couldn't escape dest directory. '..' is only allowed after existing
+// directories, so the resolved path couldn't be changed by entries extracted later.
+// it returns the resolved path relative to dest directory and whether it exists.
+func (e *archiveExtractor) resolve(name string, hops int) ([]string, bool, error) {
+	var (
+		resolved []string
+		missing  bool
+	)
+	for _, sec := range strings.Split(name, "/") {
+		switch sec {
+		case "", ".":
+			continue
+		case "..":
+			if missing {
+				return nil, false, fmt.Errorf("path traverses missing directory: %s", name)
+			}
+			if len(resolved) == 0 {
+				return nil, false, fmt.Errorf("path is outside of dest directory: %s", name)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		resolved = append(resolved, sec)
+		if missing {
+			continue
+		}
+		p := filepath.Join(e.dest, filepath.FromSlash(strings.Join(resolved, "/")))
+		stat, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			missing = true
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if stat.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if hops >= maxSymlinkHops {
+			return nil, false, fmt.Errorf("too many levels of symbolic links: %s", name)
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, false, err
+		}
+		target = strings.ReplaceAll(target, "\\", "/")
+		if path.IsAbs(target) || filepath.VolumeName(target) != "" {
+			return nil, false, fmt.Errorf("path is outside of dest directory: %s", name)
+		}
+		// target isn't cleaned, '..' must be resolved after symlinks
+		parent := strings.Join(resolved[:len(resolved)-1], "/")
+		var exist bool
+		resolved, exist, err = e.resolve(parent+"/"+target, hops+1)
+		if err != nil {
+			return nil, false, err
+		}
+		missing = !exist
+	}
+	return resolved, !missing, nil
+}
+
+func (e *archiveExtractor) extractSymlink(name, linkname string) error {
+	linkname = strings.ReplaceAll(linkname, "\\", "/")
+	if path.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return fmt.Errorf("symlink target is outside of dest directory: %s -> %s", name, linkname)
+	}
+	target, err := e.prepare(name, false)
+	if err != nil {
+		return err
+	}
+	_, _, err = e.resolve(path.Dir(name)+"/"+linkname, 0)
+	if err != nil {
+		return fmt.Errorf("invalid symlink target: %s -> %s, %w", name, linkname, err)
+	}
+	return os.Symlink(filepath.FromSlash(linkname), target)
+}
+
+func (e *archiveExtractor) extractHardlink(name, linkname string) error {
+	linkname, err := e.entryPath(linkname)
+	if err != nil {
+		return err
+	}
+	if linkname == "" {
+		return fmt.Errorf("hard link target is stripped: %s", name)
+	}
+	resolved, exist, err := e.resolve(linkname, 0)
+	if err != nil {
+		return fmt.Errorf("invalid hard link target: %s -> %s, %w", name, linkname, err)
+	}
+	if !exist {
+		return fmt.Errorf("hard link target doesn't exist: %s -> %s", name, linkname)
+	}
+	target, err := e.prepare(name, false)
+	if err != nil {
+		return err
+	}
+	return os.Link(filepath.Join(e.dest, filepath.FromSlash(strings.Join(resolved, "/"))), target)
+}
+
+// fixDirs restores directory modes and mtimes, children first.
+func (e *archiveExtractor) fixDirs() error {
+	sort.Slice(e.dirs, func(i, j int) bool {
+		return e.dirs[i].path > e.dirs[j].path
+	})
+	for _, d := range e.dirs {
+		err := os.Chmod(d.path, d.mode)
+		if err == nil {
+			err = os.Chtimes(d.path, d.mtime, d.mtime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractArchive extracts tar, tar.gz, tar.bz2 or zip archive into dest directory, modes, mtimes
+// and symlinks are kept, existing files are overwritten.
+func extractArchive(src, dest string, opts extractOptions) (int, error) {
+	format, err := archiveFormat(opts.format, src)
+	if err != nil {
+		return 0, err
+	}
+	if dest == "" {
+		dest = "."
+	}
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("create dest directory failed: %w", err)
+	}
+	e := archiveExtractor{dest: dest, opts: opts}
+	var n int
+	if format == archiveZip {
+		n, err = e.extractZip(src)
+	} else {
+		n, err = e.extractTar(src, format)
+	}
+	if err == nil {
+		err = e.fixDirs()
+	}
+	return n, err
+}
+
+func (e *archiveExtractor) extractTar(src, format string) (int, error) {
+	fd, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	var r io.Reader = fd
+	switch format {
+	case archiveTarGz:
+		gr, err := gzip.NewReader(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer gr.Close()
+		r = gr
+	case archiveTarBz2:
+		r = bzip2.NewReader(fd)
+	}
+	var n int
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		name, err := e.entryPath(hdr.Name)
+		if err != nil {
+			return n, err
+		}
+		if name == "" {
+			continue
+		}
+		isDir := hdr.Typeflag == tar.TypeDir
+		ok, err := e.included(name, isDir)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		mode := hdr.FileInfo().Mode()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = e.extractDir(name, mode, hdr.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.extractFile(name, mode, hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = e.extractSymlink(name, hdr.Linkname)
+		case tar.TypeLink:
+			err = e.extractHardlink(name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			return n, fmt.Errorf("unsupported tar entry type %c: %s", hdr.Typeflag, hdr.Name)
+		}
+		if err != nil {
+			return n, fmt.Errorf("extract entry failed: %s, %w", hdr.Name, err)
+		}
+		n++
+	}
+}
+
+func (e *archiveExtractor) extractZip(src string) (int, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	var n int
+	for _, f := range zr.File {
+		name, err := e.entryPath(f.Name)
+		if err != nil {
+			return n, err
+		}
+		if name == "" {
+			continue
+		}
+		mode := f.Mode()
+		ok, err := e.included(name, mode.IsDir())
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		err = e.extractZipFile(name, f)
+		if err != nil {
+			return n, fmt.Errorf("extract entry failed: %s, %w", f.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (e *archiveExtractor) extractZipFile(name string, f *zip.File) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return e.extractDir(name, mode, f.Modified)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return e.extractSymlink(name, string(target))
+	}
+	if !mode.IsRegular() {
+		return fmt.Errorf("unsupported zip entry mode: %s", mode)
+	}
+	return e.extractFile(name, mode, f.Modified, rc)
+}
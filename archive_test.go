@@ -0,0 +1,405 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uiez/tash/syntax"
+)
+
+type testArchiveEntry struct {
+	name string
+	typ  byte
+	// content of file, or target of link
+	body string
+}
+
+func writeTestTar(t *testing.T, file string, entries []testArchiveEntry) {
+	fd, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	tw := tar.NewWriter(fd)
+	for _, e := range entries {
+		hdr := tar.Header{Name: e.name, Typeflag: e.typ, Mode: 0644}
+		switch e.typ {
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Linkname = e.body
+		default:
+			hdr.Size = int64(len(e.body))
+		}
+		err = tw.WriteHeader(&hdr)
+		if err == nil && e.typ == tar.TypeReg {
+			_, err = tw.Write([]byte(e.body))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, file string, entries []testArchiveEntry) {
+	fd, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	zw := zip.NewWriter(fd)
+	for _, e := range entries {
+		hdr := zip.FileHeader{Name: e.name}
+		switch e.typ {
+		case tar.TypeDir:
+			hdr.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			hdr.SetMode(os.ModeSymlink | 0777)
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(&hdr)
+		if err == nil {
+			_, err = w.Write([]byte(e.body))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchiveUnsafeEntries(t *testing.T) {
+	cases := []struct {
+		desc    string
+		entries []testArchiveEntry
+	}{
+		{"parent path", []testArchiveEntry{
+			{name: "../evil", typ: tar.TypeReg, body: "evil"},
+		}},
+		{"nested parent path", []testArchiveEntry{
+			{name: "a/../../evil", typ: tar.TypeReg, body: "evil"},
+		}},
+		{"absolute path", []testArchiveEntry{
+			{name: "/tmp/evil", typ: tar.TypeReg, body: "evil"},
+		}},
+		{"absolute symlink", []testArchiveEntry{
+			{name: "link", typ: tar.TypeSymlink, body: "/"},
+		}},
+		{"parent symlink", []testArchiveEntry{
+			{name: "a/link", typ: tar.TypeSymlink, body: "../.."},
+		}},
+		{"write through symlink", []testArchiveEntry{
+			{name: "link", typ: tar.TypeSymlink, body: "."},
+			{name: "link/evil", typ: tar.TypeReg, body: "evil"},
+		}},
+		{"symlink chain", []testArchiveEntry{
+			{name: "deep/", typ: tar.TypeDir},
+			{name: "deep/c", typ: tar.TypeSymlink, body: ".."},
+			{name: "x", typ: tar.TypeSymlink, body: "deep/c/.."},
+		}},
+		{"symlink chain created later", []testArchiveEntry{
+			{name: "deep/", typ: tar.TypeDir},
+			{name: "deep/c", typ: tar.TypeSymlink, body: ".."},
+			{name: "x", typ: tar.TypeSymlink, body: "b/.."},
+			{name: "b", typ: tar.TypeSymlink, body: "deep/c"},
+		}},
+		{"symlink cycle", []testArchiveEntry{
+			{name: "a", typ: tar.TypeSymlink, body: "b"},
+			{name: "b", typ: tar.TypeSymlink, body: "a/.."},
+		}},
+	}
+	formats := []struct {
+		ext   string
+		write func(*testing.T, string, []testArchiveEntry)
+	}{
+		{".tar", writeTestTar},
+		{".zip", writeTestZip},
+	}
+	for _, c := range cases {
+		for _, f := range formats {
+			func() {
+				dir, err := ioutil.TempDir("", "tash-extract")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dir)
+				src := filepath.Join(dir, "src"+f.ext)
+				dest := filepath.Join(dir, "a", "b", "dest")
+				f.write(t, src, c.entries)
+
+				_, err = extractArchive(src, dest, extractOptions{})
+				if err == nil {
+					t.Errorf("%s%s: extracting should fail", c.desc, f.ext)
+				}
+				err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+					if info.Name() == "evil" {
+						t.Errorf("%s%s: file is written outside of dest: %s", c.desc, f.ext, p)
+					}
+					if info.Mode()&os.ModeSymlink != 0 {
+						real, err := filepath.EvalSymlinks(p)
+						if err == nil && !strings.HasPrefix(real+string(filepath.Separator), dest+string(filepath.Separator)) {
+							t.Errorf("%s%s: symlink points to outside of dest: %s -> %s", c.desc, f.ext, p, real)
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}()
+		}
+	}
+}
+
+func TestExtractArchiveHardlinkThroughSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "dest")
+	err = os.MkdirAll(dest, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600)
+	}
+	if err == nil {
+		// existing symlink in dest directory
+		err = os.Symlink("..", filepath.Join(dest, "up"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entries := range [][]testArchiveEntry{
+		{{name: "h", typ: tar.TypeLink, body: "up/secret"}},
+		{{name: "up/evil", typ: tar.TypeReg, body: "evil"}},
+	} {
+		src := filepath.Join(dir, "src.tar")
+		writeTestTar(t, src, entries)
+		_, err = extractArchive(src, dest, extractOptions{})
+		if err == nil {
+			t.Errorf("extracting %s should fail", entries[0].name)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "h")); err == nil {
+		t.Errorf("hard link to outside file is created")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "evil")); err == nil {
+		t.Errorf("file is written through symlink")
+	}
+}
+
+func TestExtractArchiveLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.tar")
+	dest := filepath.Join(dir, "dest")
+	writeTestTar(t, src, []testArchiveEntry{
+		{name: "a/b/", typ: tar.TypeDir},
+		{name: "a/f", typ: tar.TypeReg, body: "content"},
+		{name: "a/b/l", typ: tar.TypeSymlink, body: "../f"},
+		{name: "s", typ: tar.TypeSymlink, body: "a/b/l"},
+		{name: "p/q/l", typ: tar.TypeSymlink, body: "../../a/./f"},
+		{name: "h", typ: tar.TypeLink, body: "s"},
+		{name: "later", typ: tar.TypeSymlink, body: "missing/file"},
+	})
+	n, err := extractArchive(src, dest, extractOptions{})
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if n != 7 {
+		t.Errorf("want 7 entries extracted, got %d", n)
+	}
+	for _, name := range []string{"a/b/l", "s", "p/q/l", "h"} {
+		content, err := ioutil.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(content) != "content" {
+			t.Errorf("read %s: %q, %v", name, content, err)
+		}
+	}
+	stat, err := os.Lstat(filepath.Join(dest, "h"))
+	if err != nil || !stat.Mode().IsRegular() {
+		t.Errorf("hard link should be regular file: %v", err)
+	}
+}
+
+// chdirTemp changes working directory to a temporary directory, archive entry names are relative to it.
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	return dir
+}
+
+// readTestArchive returns entry names and timestamps of tar, tar.gz or zip archive.
+func readTestArchive(t *testing.T, file string) ([]string, []time.Time) {
+	var (
+		names []string
+		times []time.Time
+	)
+	if strings.HasSuffix(file, ".zip") {
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			times = append(times, f.Modified.UTC())
+		}
+		return names, times
+	}
+	fd, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	var r io.Reader = fd
+	if strings.HasSuffix(file, ".gz") {
+		gr, err := gzip.NewReader(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		times = append(times, hdr.ModTime.UTC())
+	}
+	return names, times
+}
+
+func TestCreateArchiveReproducible(t *testing.T) {
+	dir := chdirTemp(t)
+	// files are created in reverse order of names
+	writeTestTree(t, "src", map[string]string{"z": "z"})
+	writeTestTree(t, "src", map[string]string{"b/c": "c"})
+	writeTestTree(t, "src", map[string]string{"a": "a"})
+	wantNames := []string{"pkg/src/", "pkg/src/a", "pkg/src/b/", "pkg/src/b/c", "pkg/src/z"}
+
+	for _, ext := range []string{".tar", ".tar.gz", ".zip"} {
+		build := func(dest string) []byte {
+			action := syntax.ActionArchive{Dest: dest, Prefix: "pkg"}
+			n, err := createArchive(newExpandEnvs(), action, []string{"src"})
+			if err != nil {
+				t.Fatalf("create %s failed: %v", dest, err)
+			}
+			if n != len(wantNames) {
+				t.Errorf("create %s: want %d entries, got %d", dest, len(wantNames), n)
+			}
+			content, err := ioutil.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return content
+		}
+		first := build("out/first" + ext)
+		// timestamps of source files are ignored
+		later := time.Now().Add(time.Hour)
+		for _, p := range []string{"src/a", "src/b", "src/z"} {
+			err := os.Chtimes(p, later, later)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		second := build("out/second" + ext)
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: archives of the same tree are different", ext)
+		}
+		// existing dest is replaced
+		rebuilt := build("out/first" + ext)
+		if !bytes.Equal(first, rebuilt) {
+			t.Errorf("%s: rebuilt archive is different", ext)
+		}
+
+		names, times := readTestArchive(t, "out/first"+ext)
+		if !reflect.DeepEqual(names, wantNames) {
+			t.Errorf("%s: want entries %v, got %v", ext, wantNames, names)
+		}
+		for i, tm := range times {
+			if !tm.Equal(archiveEpoch) {
+				t.Errorf("%s: entry %s: want time %v, got %v", ext, names[i], archiveEpoch, tm)
+			}
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("temporary files are left in dest directory: %d files", len(files))
+	}
+}
+
+func TestCreateArchiveSourceDateEpoch(t *testing.T) {
+	chdirTemp(t)
+	writeTestTree(t, "src", map[string]string{"a": "a"})
+	want := time.Unix(1600000000, 0).UTC()
+
+	for _, ext := range []string{".tar", ".tar.gz", ".zip"} {
+		dest := "out" + ext
+		e := newExpandEnvs()
+		e.set(sourceDateEpochEnv, "1600000000")
+		_, err := createArchive(e, syntax.ActionArchive{Dest: dest}, []string{"src"})
+		if err != nil {
+			t.Fatalf("create %s failed: %v", dest, err)
+		}
+		names, times := readTestArchive(t, dest)
+		for i, tm := range times {
+			if !tm.Equal(want) {
+				t.Errorf("%s: entry %s: want time %v, got %v", ext, names[i], want, tm)
+			}
+		}
+
+		// existing dest is kept on failure
+		e.set(sourceDateEpochEnv, "yesterday")
+		_, err = createArchive(e, syntax.ActionArchive{Dest: dest}, []string{"src"})
+		if err == nil {
+			t.Errorf("%s: invalid %s should be reported", ext, sourceDateEpochEnv)
+		}
+		names, _ = readTestArchive(t, dest)
+		if !reflect.DeepEqual(names, []string{"src/", "src/a"}) {
+			t.Errorf("%s: existing archive is changed: %v", ext, names)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uiez/tash/syntax"
+)
+
+// condition is the compiled boolean expression of 'on' and 'if.check', such as
+// '$HOST_OS == linux && (-f go.mod || -d vendor)'.
+//
+// operands are expanded individually after parsing, so expanded values couldn't change the expression.
+// single operand is checked as boolean value.
+//
+// grammar:
+//
+//	expr    = and {'||' and}
+//	and     = unary {'&&' unary}
+//	unary   = '!' unary | primary
+//	primary = '(' expr ')' | unaryOp operand | operand [binaryOp operand]
+type condition struct {
+	// logical operator: '&&', '||', '!', empty for check node
+	logic string
+	nodes []*condition
+
+	// check node
+	operator string
+	value    string
+	compare  *string
+}
+
+type conditionToken struct {
+	offset int
+	text   string
+	// '(', ')', '&&', '||', '!', not operand or operator
+	isSymbol bool
+}
+
+var conditions expansionCache
+
+type conditionCache struct {
+	cond *condition
+	err  error
+}
+
+func compileCondition(s string) (*condition, error) {
+	c := conditions.load(s, func() interface{} {
+		cond, err := parseCondition(s)
+		return &conditionCache{cond: cond, err: err}
+	}).(*conditionCache)
+	return c.cond, c.err
+}
+
+// tokenizeCondition splits expression by spaces and symbols outside of quotes and braces,
+// '&&', '||' and '!' are only recognized at the beginning of word, such as 'a&&b' is a single word.
+func tokenizeCondition(s string) ([]conditionToken, error) {
+	var (
+		toks  []conditionToken
+		begin = -1
+		depth int
+		quote byte
+	)
+	endWord := func(i int) {
+		if begin >= 0 {
+			toks = append(toks, conditionToken{offset: begin, text: s[begin:i]})
+			begin = -1
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if begin < 0 {
+				begin = i
+			}
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case depth > 0:
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			case '"', '\'':
+				quote = c
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			endWord(i)
+		case c == '(' || c == ')':
+			endWord(i)
+			toks = append(toks, conditionToken{offset: i, text: s[i : i+1], isSymbol: true})
+		case begin < 0 && (strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||")):
+			toks = append(toks, conditionToken{offset: i, text: s[i : i+2], isSymbol: true})
+			i++
+		case begin < 0 && c == '!' && !strings.HasPrefix(s[i:], "!="):
+			toks = append(toks, conditionToken{offset: i, text: "!", isSymbol: true})
+		default:
+			if begin < 0 {
+				begin = i
+			}
+			switch c {
+			case '{':
+				depth++
+			case '"', '\'':
+				quote = c
+			}
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("at offset %d: unterminated quote", len(s))
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("at offset %d: unterminated brace", len(s))
+	}
+	endWord(len(s))
+	return toks, nil
+}
+
+type conditionParser struct {
+	source string
+	toks   []conditionToken
+	pos    int
+}
+
+func parseCondition(s string) (*condition, error) {
+	toks, err := tokenizeCondition(s)
+	if err != nil {
+		return nil, err
+	}
+	p := conditionParser{source: s, toks: toks}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, p.errorf(tok.offset, "unexpected token: %s", tok.text)
+	}
+	return cond, nil
+}
+
+func (p *conditionParser) errorf(offset int, format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", offset, fmt.Sprintf(format, args...))
+}
+
+func (p *conditionParser) peek() (conditionToken, bool) {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos], true
+	}
+	return conditionToken{}, false
+}
+
+func (p *conditionParser) acceptSymbol(sym string) bool {
+	tok, ok := p.peek()
+	if ok && tok.isSymbol && tok.text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) parseOr() (*condition, error) {
+	return p.parseLogic("||", p.parseAnd)
+}
+
+func (p *conditionParser) parseAnd() (*condition, error) {
+	return p.parseLogic("&&", p.parseUnary)
+}
+
+func (p *conditionParser) parseLogic(logic string, next func() (*condition, error)) (*condition, error) {
+	cond, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol(logic) {
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if cond.logic == logic {
+			cond.nodes = append(cond.nodes, right)
+		} else {
+			cond = &condition{logic: logic, nodes: []*condition{cond, right}}
+		}
+	}
+	return cond, nil
+}
+
+func (p *conditionParser) parseUnary() (*condition, error) {
+	if p.acceptSymbol("!") {
+		cond, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condition{logic: "!", nodes: []*condition{cond}}, nil
+	}
+	return p.parsePrimary()
+}
+
+// operator resolves alias of token, empty if it's not operator.
+func (p *conditionParser) operator(tok conditionToken) string {
+	if tok.isSymbol {
+		return ""
+	}
+	op := tok.text
+	if a, has := syntax.OperatorAlias[op]; has {
+		op = a
+	}
+	if !syntax.IsValidOP(op) {
+		return ""
+	}
+	return op
+}
+
+func (p *conditionParser) parseOperand() (string, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return "", p.errorf(len(p.source), "missing operand")
+	}
+	if tok.isSymbol {
+		return "", p.errorf(tok.offset, "missing operand before: %s", tok.text)
+	}
+	p.pos++
+	return stringUnquote(tok.text), nil
+}
+
+func (p *conditionParser) parsePrimary() (*condition, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, p.errorf(len(p.source), "unexpected end of expression")
+	}
+	if p.acceptSymbol("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(")") {
+			offset := len(p.source)
+			if tok, ok := p.peek(); ok {
+				offset = tok.offset
+			}
+			return nil, p.errorf(offset, "missing ')' for '(' at offset %d", tok.offset)
+		}
+		return cond, nil
+	}
+	if tok.isSymbol {
+		return nil, p.errorf(tok.offset, "unexpected token: %s", tok.text)
+	}
+
+	if op := p.operator(tok); op != "" && syntax.IsUnaryOP(op) {
+		p.pos++
+		value, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &condition{operator: op, value: value}, nil
+	}
+	value, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	next, ok := p.peek()
+	if !ok {
+		return &condition{operator: syntax.Op_bool_true, value: value}, nil
+	}
+	op := p.operator(next)
+	if op == "" {
+		if next.isSymbol {
+			return &condition{operator: syntax.Op_bool_true, value: value}, nil
+		}
+		return nil, p.errorf(next.offset, "invalid operator: %s", next.text)
+	}
+	if syntax.IsUnaryOP(op) {
+		return nil, p.errorf(next.offset, "operator doesn't needs compare field: %s", next.text)
+	}
+	p.pos++
+	compare, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &condition{operator: op, value: value, compare: &compare}, nil
+}
+
+// eval evaluates condition with short-circuit.
+func (c *condition) eval(envs *ExpandEnvs) (bool, error) {
+	switch c.logic {
+	case "!":
+		ok, err := c.nodes[0].eval(envs)
+		return !ok, err
+	case "&&", "||":
+		for _, n := range c.nodes {
+			ok, err := n.eval(envs)
+			if err != nil {
+				return false, err
+			}
+			if ok == (c.logic == "||") {
+				return ok, nil
+			}
+		}
+		return c.logic == "&&", nil
+	}
+
+	value, err := envs.expandString(c.value)
+	if err != nil {
+		return false, fmt.Errorf("expand string failed: %s, %w", c.value, err)
+	}
+	var compare *string
+	if c.compare != nil {
+		s, err := envs.expandString(*c.compare)
+		if err != nil {
+			return false, fmt.Errorf("expand string failed: %s, %w", *c.compare, err)
+		}
+		compare = &s
+	}
+	return checkCondition(envs, value, c.operator, compare)
+}
+
+// evalCondition compiles and evaluates boolean expression.
+func evalCondition(envs *ExpandEnvs, s string) (bool, error) {
+	cond, err := compileCondition(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid condition expression: %s, %w", s, err)
+	}
+	return cond.eval(envs)
+}
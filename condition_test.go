@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestConditionEnvs(t *testing.T) *ExpandEnvs {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	err := ioutil.WriteFile(file, []byte("content"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newExpandEnvs()
+	e.set("A", "abc")
+	e.set("S", "x y")
+	e.set("T", "true")
+	e.set("F", "false")
+	e.set("DIR", filepath.ToSlash(dir))
+	e.set("FILE", filepath.ToSlash(file))
+	return e
+}
+
+func TestEvalCondition(t *testing.T) {
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		// '&&' binds tighter than '||'
+		{"true || false && false", true},
+		{"false && false || true", true},
+		{"( true || false ) && false", false},
+		{"$T || $F && $F", true},
+
+		// '!' negates comparison, or parenthesised group
+		{"! $A == abc", false},
+		{"! $A == x", true},
+		{"!($A == x) && $A == abc", true},
+		{"! ( $A == x || $A == abc )", false},
+		{"!(false) && !!true", true},
+		{"! false || false", true},
+		{"$A != abc", false},
+
+		// quoted operands
+		{`"a b" == "a b"`, true},
+		{`"$S" == 'x y'`, true},
+		{`"$S" == x`, false},
+		{`"a && b" == "a && b"`, true},
+		{`"(" == "("`, true},
+		{`${A | string.transform replace b " "} == "a c"`, true},
+
+		// unary file operators and binary operators
+		{"-f $FILE", true},
+		{"-d $FILE", false},
+		{"-d $DIR && ! -f $DIR", true},
+		{"-e $DIR/missing", false},
+		{"-n $A && -z ''", true},
+		{"-f $FILE && $A == abc", true},
+		{"$A == -f", false},
+		{"10 -gt 9 && 10 > 9", false},
+		{"10 -gt 9 && b > a", true},
+		{"$A =~ ^a.c$", true},
+	}
+	for _, c := range cases {
+		e := newTestConditionEnvs(t)
+		got, err := evalCondition(e, c.expr)
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("eval %q: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+}
+
+func TestEvalConditionShortCircuit(t *testing.T) {
+	// the failing operand is only evaluated if it's needed
+	const failing = "${A | no.such.filter}"
+	cases := []struct {
+		expr string
+		want bool
+		fail bool
+	}{
+		{expr: "true || " + failing, want: true},
+		{expr: "$A == abc || " + failing + " == x", want: true},
+		{expr: "false && " + failing, want: false},
+		{expr: "true || false && " + failing, want: true},
+		{expr: "(false || true) || " + failing, want: true},
+		{expr: "false || " + failing, fail: true},
+		{expr: "true && " + failing, fail: true},
+		{expr: "! " + failing, fail: true},
+	}
+	for _, c := range cases {
+		e := newTestConditionEnvs(t)
+		got, err := evalCondition(e, c.expr)
+		if c.fail {
+			if err == nil {
+				t.Errorf("eval %q: want error, got %v", c.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("eval %q: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{"(a", "at offset 2: missing ')' for '(' at offset 0"},
+		{"a ==", "at offset 4: missing operand"},
+		{"true false", "at offset 5: invalid operator: false"},
+		{"a == b c", "at offset 7: unexpected token: c"},
+		{"a )", "at offset 2: unexpected token: )"},
+		{"a &&", "at offset 4: unexpected end of expression"},
+		{"&& a", "at offset 0: unexpected token: &&"},
+		{"$A -n", "at offset 3: operator doesn't needs compare field: -n"},
+		{"-f", "at offset 2: missing operand"},
+		{"-f == -f", "at offset 6: unexpected token: -f"},
+		{`"a b == c`, "at offset 9: unterminated quote"},
+		{"${A == c", "at offset 8: unterminated brace"},
+	}
+	for _, c := range cases {
+		_, err := parseCondition(c.expr)
+		if err == nil {
+			t.Errorf("parse %q: want error %q", c.expr, c.err)
+			continue
+		}
+		if err.Error() != c.err {
+			t.Errorf("parse %q: want error %q, got %q", c.expr, c.err, err)
+		}
+	}
+}
+
+func TestParseConditionTree(t *testing.T) {
+	cond, err := parseCondition("a || b && c || ! d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var format func(c *condition) string
+	format = func(c *condition) string {
+		if c.logic == "" {
+			return c.value
+		}
+		var nodes []string
+		for _, n := range c.nodes {
+			nodes = append(nodes, format(n))
+		}
+		if c.logic == "!" {
+			return "!" + nodes[0]
+		}
+		return "(" + strings.Join(nodes, " "+c.logic+" ") + ")"
+	}
+	if got := format(cond); got != "(a || (b && c) || !d)" {
+		t.Errorf("unexpected expression tree: %s", got)
+	}
+}
+
+func TestFileContentConditions(t *testing.T) {
+	e := newTestConditionEnvs(t)
+	file, _ := e.get("FILE")
+	missing := file + ".missing"
+	cases := []struct {
+		value    string
+		operator string
+		compare  string
+		want     bool
+		fail     bool
+	}{
+		{value: file, operator: "file.contains", compare: "ten", want: true},
+		{value: file, operator: "file.contains", compare: "content", want: true},
+		{value: file, operator: "file.contains", compare: "", want: true},
+		{value: file, operator: "file.contains", compare: "Content", want: false},
+		{value: file, operator: "file.contains", compare: "contents", want: false},
+		{value: missing, operator: "file.contains", compare: "content", want: false},
+
+		{value: file, operator: "file.hashEqual", compare: "sha256:ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73", want: true},
+		{value: file, operator: "file.hashEqual", compare: "SHA256:ED7002B439E9AC845F22357D822BAC1444730FBDB6016D3EC9432297B9EC9F73", want: true},
+		{value: file, operator: "file.hashEqual", compare: "md5:9a0364b9e99bb480dd25e1f0284c8555", want: true},
+		{value: file, operator: "file.hashEqual", compare: "sha1:040f06fd774092478d450774f5ba30c5da78acc8", want: true},
+		{value: file, operator: "file.hashEqual", compare: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", want: false},
+		{value: file, operator: "file.hashEqual", compare: "md5:ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73", want: false},
+		{value: missing, operator: "file.hashEqual", compare: "md5:9a0364b9e99bb480dd25e1f0284c8555", want: false},
+		{value: file, operator: "file.hashEqual", compare: "crc32:4d0bbc4c", fail: true},
+		{value: missing, operator: "file.hashEqual", compare: "crc32:4d0bbc4c", fail: true},
+		{value: file, operator: "file.hashEqual", compare: "9a0364b9e99bb480dd25e1f0284c8555", fail: true},
+		{value: file, operator: "file.hashEqual", compare: "md5:", fail: true},
+	}
+	for _, c := range cases {
+		got, err := checkCondition(e, c.value, c.operator, &c.compare)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s %s %q: want error, got %v", c.value, c.operator, c.compare, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s %q failed: %v", c.value, c.operator, c.compare, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s %s %q: want %v, got %v", c.value, c.operator, c.compare, c.want, got)
+		}
+	}
+}
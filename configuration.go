@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/ghodss/yaml"
 	"github.com/uiez/tash/syntax"
 )
 
@@ -20,9 +19,13 @@ type Configuration struct {
 	// defines tasks
 	// the key is task name
 	Tasks map[string]syntax.Task
+
+	// defines user expand filters
+	// the key is filter name
+	Filters map[string]syntax.ExpandFilter
 }
 
-func parseConfiguration(log indentLogger, conf string, saveConf bool) *Configuration {
+func parseConfiguration(log indentLogger, conf string, saveConf bool) (*Configuration, string) {
 	currDir, _ := os.Getwd()
 
 	if conf == "" {
@@ -45,11 +48,16 @@ func parseConfiguration(log indentLogger, conf string, saveConf bool) *Configura
 			}
 		}
 	}
+	return loadConfiguration(log, currDir, conf), conf
+}
+
+func loadConfiguration(log indentLogger, baseDir, conf string) *Configuration {
 	c := &Configuration{
 		Templates: make(map[string]syntax.ActionList),
 		Tasks:     make(map[string]syntax.Task),
+		Filters:   make(map[string]syntax.ExpandFilter),
 	}
-	c.buildFrom(log, currDir, conf)
+	c.buildFrom(log, baseDir, conf)
 	return c
 }
 
@@ -67,11 +75,9 @@ func lookupConfigurationPath(currDir string) (path string, isRecorded bool) {
 		}
 	}
 
-	const defaultConf = "tash.yaml"
 	for dir := currDir; ; {
-		path := filepath.Join(dir, defaultConf)
-		stat, err := os.Stat(path)
-		if err == nil && !stat.IsDir() {
+		path := lookupConfigurationInDir(dir)
+		if path != "" {
 			relpath, err := filepath.Rel(currDir, path)
 			if err != nil {
 				return path, false
@@ -86,6 +92,20 @@ func lookupConfigurationPath(currDir string) (path string, isRecorded bool) {
 	}
 }
 
+// default config file names, searched in order
+var defaultConfs = []string{"tash.yaml", "tash.yml", "tash.json", "tash.toml"}
+
+func lookupConfigurationInDir(dir string) string {
+	for _, name := range defaultConfs {
+		path := filepath.Join(dir, name)
+		stat, err := os.Stat(path)
+		if err == nil && !stat.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
 func (c *Configuration) importPath(log indentLogger, baseDir, path string) {
 	var relpath string
 	{
@@ -131,7 +151,7 @@ func (c *Configuration) importPath(log indentLogger, baseDir, path string) {
 		}
 	default:
 		log.debugln("ignore file:", relpath)
-	case ".yaml", ".yml":
+	case ".yaml", ".yml", ".json", ".toml":
 		log.debugln("import tash config file:", relpath)
 		c.buildFrom(log.addIndent(), baseDir, path)
 	}
@@ -144,8 +164,12 @@ func (c *Configuration) buildFrom(log indentLogger, baseDir, path string) {
 		return
 	}
 
+	name, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		name = path
+	}
 	var configs syntax.Configuration
-	err = yaml.Unmarshal(content, &configs)
+	err = unmarshalConfiguration(path, stringToSlash(name), content, &configs)
 	if err != nil {
 		log.fatalln("parsing config file failed:", path, err)
 		return
@@ -183,4 +207,17 @@ func (c *Configuration) buildFrom(log indentLogger, baseDir, path string) {
 		}
 		c.Tasks[name] = task
 	}
+	for name, filter := range configs.Filters {
+		_, has := c.Filters[name]
+		if has {
+			log.fatalln("duplicated filter definition:", name)
+		}
+		if isBuiltinFilter(name) || syntax.IsValidOP(name) {
+			log.fatalln("filter definition conflicts with builtin filter:", name)
+		}
+		if (filter.Pipeline == "") == (filter.Cmd == "") {
+			log.fatalln("filter should be defined by exactly one of pipeline and cmd:", name)
+		}
+		c.Filters[name] = filter
+	}
 }
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/uiez/tash/syntax"
+	"gopkg.in/yaml.v3"
+)
+
+type confNodeKind int
+
+const (
+	confScalar confNodeKind = iota
+	confMapping
+	confSequence
+)
+
+// confNode is the document tree of config file with source positions.
+//
+// it's encoded to json guided by the target type, so all formats share the json decoding rules of syntax types,
+// and source positions are filled into the position field of structs.
+type confNode struct {
+	kind confNodeKind
+	pos  syntax.Position
+
+	// scalar typed value and raw text
+	value interface{}
+	text  string
+
+	// mapping keys, mapping values or sequence items
+	keys  []string
+	nodes []*confNode
+}
+
+// unmarshalConfiguration decodes config file content by file extension, yaml by default.
+// json is decoded as yaml document since it's a subset of yaml.
+//
+// the name is used to fill source positions.
+func unmarshalConfiguration(path, name string, content []byte, v interface{}) error {
+	var (
+		node *confNode
+		err  error
+	)
+	switch filepath.Ext(path) {
+	case ".toml":
+		node, err = parseTomlNode(name, content)
+	default:
+		node, err = parseYamlNode(name, content)
+	}
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	err = node.encode(&buf, reflect.TypeOf(v))
+	if err != nil {
+		return fmt.Errorf("convert to json failed: %w", err)
+	}
+	return json.Unmarshal(buf.Bytes(), v)
+}
+
+// convertToJson converts yaml, toml or ini document to json with keys order preserved, empty document is converted to empty string.
+func convertToJson(format string, content []byte) (string, error) {
+	var (
+		node *confNode
+		err  error
+	)
+	switch format {
+	case "toml":
+		node, err = parseTomlNode("", content)
+	case "ini":
+		node, err = parseIniNode("", content)
+	default:
+		node, err = parseYamlNode("", content)
+	}
+	if err != nil {
+		return "", fmt.Errorf("parse %s failed: %w", format, err)
+	}
+	if node == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	err = node.encode(&buf, nil)
+	if err != nil {
+		return "", fmt.Errorf("convert to json failed: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func parseYamlNode(name string, content []byte) (*confNode, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return convertYamlNode(name, doc.Content[0])
+}
+
+func convertYamlNode(name string, n *yaml.Node) (*confNode, error) {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	node := confNode{
+		pos: syntax.Position{File: name, Line: n.Line, Col: n.Column},
+	}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		node.kind = confScalar
+		node.text = n.Value
+		err := n.Decode(&node.value)
+		if err != nil {
+			return nil, err
+		}
+	case yaml.SequenceNode:
+		node.kind = confSequence
+		for _, c := range n.Content {
+			item, err := convertYamlNode(name, c)
+			if err != nil {
+				return nil, err
+			}
+			node.nodes = append(node.nodes, item)
+		}
+	case yaml.MappingNode:
+		node.kind = confMapping
+		var merges []*confNode
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			val, err := convertYamlNode(name, v)
+			if err != nil {
+				return nil, err
+			}
+			if k.Tag == "!!merge" {
+				switch val.kind {
+				case confMapping:
+					merges = append(merges, val)
+				case confSequence:
+					merges = append(merges, val.nodes...)
+				}
+				continue
+			}
+			node.set(k.Value, val, true)
+		}
+		for _, m := range merges {
+			for i, k := range m.keys {
+				node.set(k, m.nodes[i], false)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported yaml node at %d:%d", n.Line, n.Column)
+	}
+	return &node, nil
+}
+
+func (n *confNode) set(key string, val *confNode, override bool) {
+	for i, k := range n.keys {
+		if k == key {
+			if override {
+				n.nodes[i] = val
+			}
+			return
+		}
+	}
+	n.keys = append(n.keys, key)
+	n.nodes = append(n.nodes, val)
+}
+
+func parseTomlNode(name string, content []byte) (*confNode, error) {
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, err
+	}
+	return convertTomlTree(name, tree, tree.Position()), nil
+}
+
+func convertTomlTree(name string, tree *toml.Tree, pos toml.Position) *confNode {
+	node := confNode{
+		kind: confMapping,
+		pos:  syntax.Position{File: name, Line: pos.Line, Col: pos.Col},
+	}
+	keys := tree.Keys()
+	// go-toml doesn't keep key order, recover it by positions
+	sort.SliceStable(keys, func(i, j int) bool {
+		return tomlPositionLess(tree.GetPosition(keys[i]), tree.GetPosition(keys[j]))
+	})
+	for _, k := range keys {
+		kpos := tree.GetPosition(k)
+		if kpos.Invalid() {
+			// such as arrays of inline tables
+			kpos = pos
+		}
+		node.keys = append(node.keys, k)
+		node.nodes = append(node.nodes, convertTomlValue(name, kpos, tree.Get(k)))
+	}
+	return &node
+}
+
+// tomlPositionLess sorts invalid positions to the end
+func tomlPositionLess(p1, p2 toml.Position) bool {
+	if p1.Invalid() || p2.Invalid() {
+		return !p1.Invalid() && p2.Invalid()
+	}
+	if p1.Line != p2.Line {
+		return p1.Line < p2.Line
+	}
+	return p1.Col < p2.Col
+}
+
+func convertTomlValue(name string, pos toml.Position, v interface{}) *confNode {
+	switch v := v.(type) {
+	case *toml.Tree:
+		return convertTomlTree(name, v, pos)
+	case []*toml.Tree:
+		node := confNode{
+			kind: confSequence,
+			pos:  syntax.Position{File: name, Line: pos.Line, Col: pos.Col},
+		}
+		for _, t := range v {
+			tpos := t.Position()
+			if tpos.Invalid() {
+				// inline tables
+				tpos = pos
+			}
+			node.nodes = append(node.nodes, convertTomlTree(name, t, tpos))
+		}
+		return &node
+	case []interface{}:
+		node := confNode{
+			kind: confSequence,
+			pos:  syntax.Position{File: name, Line: pos.Line, Col: pos.Col},
+		}
+		for _, item := range v {
+			node.nodes = append(node.nodes, convertTomlValue(name, pos, item))
+		}
+		return &node
+	default:
+		return &confNode{
+			kind:  confScalar,
+			pos:   syntax.Position{File: name, Line: pos.Line, Col: pos.Col},
+			value: v,
+			text:  fmt.Sprint(v),
+		}
+	}
+}
+
+// parseIniNode parses ini document, keys before first section are placed at top level.
+//
+// values are kept as is, indented lines after key are treated as continuation lines of value, such as setup.cfg.
+func parseIniNode(name string, content []byte) (*confNode, error) {
+	newNode := func(kind confNodeKind, line, col int) *confNode {
+		return &confNode{
+			kind: kind,
+			pos:  syntax.Position{File: name, Line: line, Col: col},
+		}
+	}
+	var (
+		root    = newNode(confMapping, 1, 1)
+		section = root
+		last    *confNode
+	)
+	for i, line := range strings.Split(string(content), "\n") {
+		lineno := i + 1
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		if last != nil && (line[0] == ' ' || line[0] == '\t') {
+			if last.text != "" {
+				last.text += "\n"
+			}
+			last.text += trimmed
+			last.value = last.text
+			continue
+		}
+		last = nil
+		if trimmed[0] == '[' {
+			if trimmed[len(trimmed)-1] != ']' {
+				return nil, fmt.Errorf("invalid section at line %d: %s", lineno, trimmed)
+			}
+			secName := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			section = nil
+			for i, k := range root.keys {
+				if k == secName && root.nodes[i].kind == confMapping {
+					section = root.nodes[i]
+					break
+				}
+			}
+			if section == nil {
+				section = newNode(confMapping, lineno, 1)
+				root.set(secName, section, true)
+			}
+			continue
+		}
+		var key, val string
+		if idx := strings.IndexAny(trimmed, "=:"); idx >= 0 {
+			key = strings.TrimSpace(trimmed[:idx])
+			val = strings.TrimSpace(trimmed[idx+1:])
+		} else {
+			key = trimmed
+		}
+		last = newNode(confScalar, lineno, 1)
+		last.value = val
+		last.text = val
+		section.set(key, last, true)
+	}
+	return root, nil
+}
+
+var (
+	positionType    = reflect.TypeOf(syntax.Position{})
+	actionListType  = reflect.TypeOf(syntax.ActionList{})
+	envListType     = reflect.TypeOf(syntax.EnvList{})
+	stringListType  = reflect.TypeOf(syntax.StringList{})
+	switchCaseType  = reflect.TypeOf(syntax.SwitchCase{})
+	switchCasesType = reflect.TypeOf(syntax.SwitchCases{})
+)
+
+// encode writes node as json, typ is the decoding target type, nil if unknown.
+func (n *confNode) encode(buf *bytes.Buffer, typ reflect.Type) error {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	// union types, single element or list
+	switch typ {
+	case actionListType:
+		return n.encodeUnion(buf, reflect.TypeOf(syntax.Action{}))
+	case envListType, stringListType:
+		return n.encodeUnion(buf, reflect.TypeOf(""))
+	case switchCasesType:
+		// mapping keeps key order in json, it's decoded in order
+		if n.kind == confSequence {
+			return n.encode(buf, reflect.SliceOf(switchCaseType))
+		}
+		return n.encode(buf, reflect.MapOf(reflect.TypeOf(""), actionListType))
+	}
+
+	switch n.kind {
+	case confScalar:
+		return n.encodeScalar(buf, typ)
+	case confSequence:
+		var elemType reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elemType = typ.Elem()
+		}
+		buf.WriteByte('[')
+		for i, item := range n.nodes {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := item.encode(buf, elemType)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	default:
+		var (
+			fieldType func(key string) reflect.Type
+			posField  string
+			first     = true
+		)
+		buf.WriteByte('{')
+		switch {
+		case typ == nil:
+		case typ.Kind() == reflect.Map:
+			fieldType = func(string) reflect.Type {
+				return typ.Elem()
+			}
+		case typ.Kind() == reflect.Struct:
+			fields := structJsonFields(typ)
+			fieldType = func(key string) reflect.Type {
+				if t, has := fields[key]; has {
+					return t
+				}
+				for name, t := range fields {
+					if strings.EqualFold(name, key) {
+						return t
+					}
+				}
+				return nil
+			}
+			if pos, has := structPositionField(typ); has {
+				posField = pos
+				writeJsonValue(buf, pos)
+				buf.WriteByte(':')
+				writeJsonValue(buf, n.pos)
+				first = false
+			}
+		}
+		for i, k := range n.keys {
+			// position is filled by decoder only, json field names are matched case-insensitively.
+			if posField != "" && strings.EqualFold(k, posField) {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			writeJsonValue(buf, k)
+			buf.WriteByte(':')
+			var t reflect.Type
+			if fieldType != nil {
+				t = fieldType(k)
+			}
+			err := n.nodes[i].encode(buf, t)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+}
+
+func (n *confNode) encodeUnion(buf *bytes.Buffer, elemType reflect.Type) error {
+	if n.kind == confSequence {
+		return n.encode(buf, reflect.SliceOf(elemType))
+	}
+	return n.encode(buf, elemType)
+}
+
+func (n *confNode) encodeScalar(buf *bytes.Buffer, typ reflect.Type) error {
+	if n.value == nil {
+		buf.WriteString("null")
+		return nil
+	}
+	if typ != nil && typ.Kind() == reflect.Bool {
+		// yaml 1.1 boolean words, such as 'yes' and 'off', they are plain strings in yaml 1.2.
+		if s, ok := n.value.(string); ok {
+			if b, has := yamlBoolWords[s]; has {
+				return writeJsonValue(buf, b)
+			}
+		}
+	}
+	if typ != nil && typ.Kind() == reflect.String {
+		// keep raw text for string fields, such as version numbers.
+		if s, ok := n.value.(string); ok {
+			return writeJsonValue(buf, s)
+		}
+		return writeJsonValue(buf, n.text)
+	}
+	return writeJsonValue(buf, n.value)
+}
+
+var yamlBoolWords = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+}
+
+func writeJsonValue(buf *bytes.Buffer, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(content)
+	return nil
+}
+
+// structJsonFields collects json field names and types of struct, including fields of embedded structs.
+func structJsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for name, t := range structJsonFields(f.Type) {
+				if _, has := fields[name]; !has {
+					fields[name] = t
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// structPositionField returns the json name of position field.
+func structPositionField(typ reflect.Type) (string, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Type == positionType {
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			return name, true
+		}
+	}
+	return "", false
+}
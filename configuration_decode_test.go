@@ -0,0 +1,190 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/uiez/tash/syntax"
+)
+
+func TestUnmarshalConfigurationPositions(t *testing.T) {
+	cases := []struct {
+		path    string
+		content string
+		task    syntax.Position
+		action  syntax.Position
+	}{
+		{
+			path: "tash.yaml",
+			content: `tasks:
+  build:
+    $pos: {File: fake, Line: 100}
+    actions:
+      - $POS: {File: fake, Line: 200}
+        cmd: {exec: go build}
+`,
+			task:   syntax.Position{File: "tash.yaml", Line: 3, Col: 5},
+			action: syntax.Position{File: "tash.yaml", Line: 5, Col: 9},
+		},
+		{
+			path: "tash.json",
+			content: `{
+  "tasks": {
+    "build": {
+      "$pos": {"File": "fake", "Line": 100},
+      "actions": [{"cmd": {"exec": "go build"}, "$pos": {"File": "fake", "Line": 200}}]
+    }
+  }
+}
+`,
+			task:   syntax.Position{File: "tash.json", Line: 3, Col: 14},
+			action: syntax.Position{File: "tash.json", Line: 5, Col: 19},
+		},
+		{
+			path: "tash.toml",
+			content: `[tasks.build]
+"$pos" = {File = "fake", Line = 100}
+
+[[tasks.build.actions]]
+cmd = {exec = "go build"}
+`,
+			task:   syntax.Position{File: "tash.toml", Line: 1, Col: 1},
+			action: syntax.Position{File: "tash.toml", Line: 4, Col: 1},
+		},
+	}
+	for _, c := range cases {
+		var conf syntax.Configuration
+		err := unmarshalConfiguration(c.path, c.path, []byte(c.content), &conf)
+		if err != nil {
+			t.Errorf("decode %s failed: %v", c.path, err)
+			continue
+		}
+		task := conf.Tasks["build"]
+		if task.Pos != c.task {
+			t.Errorf("decode %s: task position want %v, got %v", c.path, c.task, task.Pos)
+		}
+		actions := task.Actions.Actions()
+		if len(actions) != 1 {
+			t.Errorf("decode %s: want 1 action, got %d", c.path, len(actions))
+			continue
+		}
+		if actions[0].Pos != c.action {
+			t.Errorf("decode %s: action position want %v, got %v", c.path, c.action, actions[0].Pos)
+		}
+		if actions[0].Cmd.Exec != "go build" {
+			t.Errorf("decode %s: unexpected cmd: %q", c.path, actions[0].Cmd.Exec)
+		}
+	}
+}
+
+func TestUnmarshalConfigurationBool(t *testing.T) {
+	cases := []struct {
+		path    string
+		content string
+		want    bool
+	}{
+		{"tash.yaml", "replace: {file: a, regexp: yes}", true},
+		{"tash.yaml", "replace: {file: a, regexp: on}", true},
+		{"tash.yaml", "replace: {file: a, regexp: Y}", true},
+		{"tash.yaml", "replace: {file: a, regexp: true}", true},
+		{"tash.yaml", "replace: {file: a, regexp: no}", false},
+		{"tash.yaml", "replace: {file: a, regexp: OFF}", false},
+		{"tash.yaml", "replace: {file: a, regexp: false}", false},
+		{"tash.json", `{"replace": {"file": "a", "regexp": true}}`, true},
+		{"tash.json", `{"replace": {"file": "a", "regexp": false}}`, false},
+		{"tash.toml", "[replace]\nfile = \"a\"\nregexp = true", true},
+		{"tash.toml", "[replace]\nfile = \"a\"\nregexp = false", false},
+	}
+	for _, c := range cases {
+		var action syntax.Action
+		err := unmarshalConfiguration(c.path, c.path, []byte(c.content), &action)
+		if err != nil {
+			t.Errorf("decode %q failed: %v", c.content, err)
+			continue
+		}
+		if action.Replace.Regexp != c.want {
+			t.Errorf("decode %q: want %v, got %v", c.content, c.want, action.Replace.Regexp)
+		}
+		if action.Replace.File != "a" {
+			t.Errorf("decode %q: unexpected file: %q", c.content, action.Replace.File)
+		}
+	}
+
+	var action syntax.Action
+	err := unmarshalConfiguration("tash.yaml", "tash.yaml", []byte("replace: {file: a, regexp: maybe}"), &action)
+	if err == nil {
+		t.Errorf("decode invalid bool word should fail")
+	}
+	err = unmarshalConfiguration("tash.yaml", "tash.yaml", []byte("echo: {content: yes, file: a}"), &action)
+	if err != nil || action.Echo.Content != "yes" {
+		t.Errorf("bool word in string field should be kept: %q, %v", action.Echo.Content, err)
+	}
+}
+
+// integer fields accept octal with leading zero, sexagesimal numbers such as 1:30 are plain strings,
+// and string fields keep the raw text instead of the decoded number.
+func TestUnmarshalConfigurationYamlScalars(t *testing.T) {
+	modes := []struct {
+		path    string
+		content string
+		want    uint
+	}{
+		{"tash.yaml", "chmod: {path: a, mode: 0755}", 0755},
+		{"tash.yaml", "chmod: {path: a, mode: 0o755}", 0755},
+		{"tash.yaml", "chmod: {path: a, mode: 0x1ed}", 0755},
+		{"tash.yaml", "chmod: {path: a, mode: 493}", 0755},
+		{"tash.yaml", "chmod: {path: a, mode: 0644}", 0644},
+		{"tash.toml", "[chmod]\npath = \"a\"\nmode = 0o755", 0755},
+		{"tash.json", `{"chmod": {"path": "a", "mode": 493}}`, 0755},
+	}
+	for _, c := range modes {
+		var action syntax.Action
+		err := unmarshalConfiguration(c.path, c.path, []byte(c.content), &action)
+		if err != nil {
+			t.Errorf("decode %q failed: %v", c.content, err)
+			continue
+		}
+		if action.Chmod.Mode != c.want {
+			t.Errorf("decode %q: want mode %o, got %o", c.content, c.want, action.Chmod.Mode)
+		}
+	}
+	var action syntax.Action
+	err := unmarshalConfiguration("tash.yaml", "tash.yaml", []byte("chmod: {path: a, mode: 1:30}"), &action)
+	if err == nil {
+		t.Errorf("decode sexagesimal number to integer field should fail, got %d", action.Chmod.Mode)
+	}
+
+	strs := []struct {
+		content string
+		want    string
+	}{
+		{"echo: {file: a, content: 1:30}", "1:30"},
+		{"echo: {file: a, content: 0755}", "0755"},
+		{"echo: {file: a, content: 1.10}", "1.10"},
+		{"echo: {file: a, content: 1e3}", "1e3"},
+		{"echo: {file: a, content: 0x1F}", "0x1F"},
+		{"echo: {file: a, content: yes}", "yes"},
+		{"echo: {file: a, content: 2001-12-14}", "2001-12-14"},
+		{"echo: {file: a, content: ~}", ""},
+	}
+	for _, c := range strs {
+		var action syntax.Action
+		err := unmarshalConfiguration("tash.yaml", "tash.yaml", []byte(c.content), &action)
+		if err != nil {
+			t.Errorf("decode %q failed: %v", c.content, err)
+			continue
+		}
+		if action.Echo.Content != c.want {
+			t.Errorf("decode %q: want %q, got %q", c.content, c.want, action.Echo.Content)
+		}
+	}
+
+	// untyped values, such as data converted by filters
+	got, err := convertToJson("yaml", []byte("a: 0755\nb: 1:30\nc: 0o755\nd: 012345678\ne: 1_000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"a":493,"b":"1:30","c":493,"d":12345678,"e":1000}`
+	if got != want {
+		t.Errorf("convert yaml scalars: want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-zglob"
+)
+
+// copyOptions controls copying of local files and directory trees.
+type copyOptions struct {
+	// path patterns relative to source root, see matchPathPattern
+	include []string
+	exclude []string
+	// copy symbolic links as links instead of their targets
+	preserveSymlinks bool
+	// ignore special files such as devices, named pipes and sockets instead of failing
+	ignoreSpecialFiles bool
+
+	// sync changed files instead of removing and copying again
+	sync bool
+	// compare file content instead of size and mtime in sync mode
+	checksum bool
+	// remove extraneous paths in sync mode
+	delete bool
+	// write files in place instead of renaming temporary files, to keep inodes of existing files
+	inPlace bool
+
+	// slash separated path of source root relative to the root of include and exclude patterns,
+	// such as directory matched by glob pattern, relative to the static prefix of pattern.
+	prefix string
+}
+
+// matchPathPattern matches slash separated path with pattern, '**' matches zero or more directories,
+// other segments are matched by path.Match. pattern without '/' matches base name.
+func matchPathPattern(pattern, name string) (bool, error) {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		return path.Match(pattern, path.Base(name))
+	}
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchPathSegments(pattern[1:], name[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// skipped checks whether relative path is filtered, include patterns are only applied to files.
+func (o *copyOptions) skipped(relPath string, isDir bool) (bool, error) {
+	relPath = filepath.ToSlash(relPath)
+	if o.prefix != "" {
+		relPath = path.Join(o.prefix, relPath)
+	}
+	for _, p := range o.exclude {
+		ok, err := matchPathPattern(p, relPath)
+		if err != nil {
+			return false, fmt.Errorf("invalid exclude pattern: %s, %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	if isDir || len(o.include) == 0 {
+		return false, nil
+	}
+	for _, p := range o.include {
+		ok, err := matchPathPattern(p, relPath)
+		if err != nil {
+			return false, fmt.Errorf("invalid include pattern: %s, %w", p, err)
+		}
+		if ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// copyFile copies file content, mode and modification time, dst is written atomically unless inPlace is set.
+func copyFile(dst, src string, inPlace bool) error {
+	srcFd, err := os.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer srcFd.Close()
+	srcStat, err := srcFd.Stat()
+	if err != nil {
+		return err
+	}
+	if !inPlace {
+		err = writeFileAtomic(dst, srcStat.Mode(), func(w io.Writer) error {
+			_, err := io.Copy(w, srcFd)
+			return err
+		})
+		if err == nil {
+			err = os.Chtimes(dst, srcStat.ModTime(), srcStat.ModTime())
+		}
+		return err
+	}
+	dstFd, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer dstFd.Close()
+	_, err = io.Copy(dstFd, srcFd)
+	if err == nil {
+		err = os.Chmod(dst, srcStat.Mode())
+	}
+	if err == nil {
+		err = os.Chtimes(dst, srcStat.ModTime(), srcStat.ModTime())
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func copySymlink(dst, src string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+type copyStats struct {
+	copied  int
+	skipped int
+	removed int
+}
+
+func (s *copyStats) add(o copyStats) {
+	s.copied += o.copied
+	s.skipped += o.skipped
+	s.removed += o.removed
+}
+
+func (s copyStats) String() string {
+	return fmt.Sprintf("%d copied, %d skipped, %d removed", s.copied, s.skipped, s.removed)
+}
+
+type sourceWalker struct {
+	opts copyOptions
+	// resolved directories being walked, to detect symlink cycles
+	visited map[string]bool
+	fn      func(relPath, srcPath string, info os.FileInfo) error
+}
+
+// walkSource walks source tree in lexical order, children are filtered by options,
+// symlinks are followed unless they are preserved. relPath of root is '.'.
+// fn could return filepath.SkipDir to skip directory contents.
+func walkSource(src string, opts copyOptions, fn func(relPath, srcPath string, info os.FileInfo) error) error {
+	w := sourceWalker{opts: opts, visited: map[string]bool{}, fn: fn}
+	return w.walk(".", src)
+}
+
+func (w *sourceWalker) walk(relPath, srcPath string) error {
+	info, err := os.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 && !w.opts.preserveSymlinks {
+		info, err = os.Stat(srcPath)
+		if err != nil {
+			return fmt.Errorf("broken symlink: %s, %w", srcPath, err)
+		}
+	}
+	mode := info.Mode()
+	if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+		if w.opts.ignoreSpecialFiles {
+			return nil
+		}
+		return fmt.Errorf("special file is not supported: %s", srcPath)
+	}
+	err = w.fn(relPath, srcPath, info)
+	if err == filepath.SkipDir && mode.IsDir() {
+		return nil
+	}
+	if err != nil || !mode.IsDir() {
+		return err
+	}
+
+	real, err := filepath.EvalSymlinks(srcPath)
+	if err != nil {
+		return err
+	}
+	if w.visited[real] {
+		return fmt.Errorf("symlink cycle detected: %s", srcPath)
+	}
+	w.visited[real] = true
+	defer delete(w.visited, real)
+
+	fd, err := os.Open(real)
+	if err != nil {
+		return err
+	}
+	names, err := fd.Readdirnames(-1)
+	fd.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childSrc := filepath.Join(real, name)
+		childRel := path.Join(relPath, name)
+		isDir := w.isDir(childSrc)
+		skip, err := w.opts.skipped(childRel, isDir)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+		err = w.walk(childRel, childSrc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *sourceWalker) isDir(path string) bool {
+	var (
+		stat os.FileInfo
+		err  error
+	)
+	if w.opts.preserveSymlinks {
+		stat, err = os.Lstat(path)
+	} else {
+		stat, err = os.Stat(path)
+	}
+	return err == nil && stat.IsDir()
+}
+
+// copyPath copies file or directory tree, dst will be removed first.
+func copyPath(dst, src string, opts copyOptions) (copyStats, error) {
+	_, err := os.Lstat(src)
+	if err != nil {
+		return copyStats{}, fmt.Errorf("read source path status failed: %w", err)
+	}
+	err = os.RemoveAll(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return copyStats{}, fmt.Errorf("remove dst path failed: %w", err)
+	}
+	return syncPath(dst, src, opts)
+}
+
+type copiedDir struct {
+	path  string
+	mode  os.FileMode
+	mtime time.Time
+}
+
+type copyJob struct {
+	dst, src string
+}
+
+// syncPath copies changed files only, files are unchanged if they have same size and mtime,
+// or same content if checksum is set. extraneous paths in dst are removed if delete is set,
+// paths filtered by include and exclude are kept.
+func syncPath(dst, src string, opts copyOptions) (copyStats, error) {
+	var stats copyStats
+	_, err := os.Lstat(src)
+	if err != nil {
+		return stats, fmt.Errorf("read source path status failed: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return stats, fmt.Errorf("create dst parent directory tree failed: %w", err)
+	}
+
+	var (
+		synced = map[string]bool{}
+		dirs   []copiedDir
+		jobs   []copyJob
+	)
+	err = walkSource(src, opts, func(relPath, srcPath string, info os.FileInfo) error {
+		synced[relPath] = true
+		target := filepath.Join(dst, relPath)
+		dstInfo, err := os.Lstat(target)
+		exist := err == nil
+		mode := info.Mode()
+		if exist && (mode.IsDir() != dstInfo.IsDir() || mode&os.ModeSymlink != dstInfo.Mode()&os.ModeSymlink) {
+			err = os.RemoveAll(target)
+			if err != nil {
+				return err
+			}
+			exist = false
+		}
+		switch {
+		case mode.IsDir():
+			if !exist {
+				err = os.Mkdir(target, 0755)
+			} else if dstInfo.Mode().Perm()&0300 != 0300 {
+				// make sure it's writable, mode is fixed later
+				err = os.Chmod(target, dstInfo.Mode()|0300)
+			}
+			dirs = append(dirs, copiedDir{path: target, mode: mode, mtime: info.ModTime()})
+			return err
+		case mode&os.ModeSymlink != 0:
+			if exist {
+				t1, e1 := os.Readlink(srcPath)
+				t2, e2 := os.Readlink(target)
+				if e1 == nil && e2 == nil && t1 == t2 {
+					stats.skipped++
+					return nil
+				}
+				err = os.Remove(target)
+				if err != nil {
+					return err
+				}
+			}
+			stats.copied++
+			return copySymlink(target, srcPath)
+		default:
+			if exist && dstInfo.Mode().IsRegular() {
+				same, err := sameFile(target, srcPath, dstInfo, info, opts.checksum)
+				if err != nil {
+					return err
+				}
+				if same {
+					stats.skipped++
+					if dstInfo.Mode() != mode {
+						err = os.Chmod(target, mode)
+					}
+					if err == nil && !dstInfo.ModTime().Equal(info.ModTime()) {
+						err = os.Chtimes(target, info.ModTime(), info.ModTime())
+					}
+					return err
+				}
+			}
+			jobs = append(jobs, copyJob{dst: target, src: srcPath})
+			return nil
+		}
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = copyFilesParallel(jobs, opts.inPlace)
+	if err != nil {
+		return stats, err
+	}
+	stats.copied += len(jobs)
+
+	if opts.delete {
+		err = filepath.Walk(dst, func(dstPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(dst, dstPath)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if synced[relPath] {
+				return nil
+			}
+			skip, err := opts.skipped(relPath, info.IsDir())
+			if err != nil {
+				return err
+			}
+			if !skip {
+				err = os.RemoveAll(dstPath)
+				if err != nil {
+					return err
+				}
+				stats.removed++
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("remove extraneous paths failed: %w", err)
+		}
+	}
+
+	// restore directory modes and mtimes, children first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		err := os.Chmod(d.path, d.mode)
+		if err == nil {
+			err = os.Chtimes(d.path, d.mtime, d.mtime)
+		}
+		if err != nil {
+			return stats, fmt.Errorf("fix dir mode failed: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+func sameFile(path1, path2 string, info1, info2 os.FileInfo, checksum bool) (bool, error) {
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+	if !checksum {
+		return info1.ModTime().Equal(info2.ModTime()), nil
+	}
+	return sameFileContent(path1, path2)
+}
+
+// copyFilesParallel copies files by workers, existing read-only files are replaced.
+func copyFilesParallel(jobs []copyJob, inPlace bool) error {
+	workers := runtime.NumCPU()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		ch       = make(chan copyJob)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				err := copyFile(job.dst, job.src, inPlace)
+				if os.IsPermission(err) {
+					os.Remove(job.dst)
+					err = copyFile(job.dst, job.src, inPlace)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("copy file failed: %s, %w", job.src, err)
+					})
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		ch <- job
+	}
+	close(ch)
+	wg.Wait()
+	return firstErr
+}
+
+// hasGlobMeta checks whether path contains meta characters of filepath.Match.
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// isGlobPattern checks whether source path block contains glob pattern or multiple blocks,
+// existing path is treated as literal path even if it contains meta characters, such as 'file[1].txt'.
+func isGlobPattern(s string) bool {
+	blocks := splitBlocks(s)
+	if len(blocks) > 1 {
+		return true
+	}
+	if len(blocks) == 0 || !hasGlobMeta(blocks[0]) {
+		return false
+	}
+	_, err := os.Lstat(blocks[0])
+	return err != nil
+}
+
+// globPath matches paths by pattern, '?' and '[...]' are supported besides '*' and '**' of zglob,
+// existing path is matched literally. it returns os.ErrNotExist if the static prefix doesn't exist.
+func globPath(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "?[") {
+		return zglob.Glob(pattern)
+	}
+	if _, err := os.Lstat(pattern); err == nil {
+		return []string{pattern}, nil
+	}
+	secs := strings.Split(filepath.ToSlash(pattern), "/")
+	var i int
+	for i < len(secs) && !hasGlobMeta(secs[i]) {
+		i++
+	}
+	patSecs := secs[i:]
+	var recursive bool
+	for _, sec := range patSecs {
+		if sec == "**" {
+			recursive = true
+		}
+	}
+	root := globBase(pattern)
+	var matched []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		relSecs := strings.Split(filepath.ToSlash(rel), "/")
+		ok, err := matchPathSegments(patSecs, relSecs)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %s, %w", pattern, err)
+		}
+		if ok {
+			if root == "." {
+				matched = append(matched, filepath.ToSlash(rel))
+			} else {
+				matched = append(matched, path.Join(root, filepath.ToSlash(rel)))
+			}
+		}
+		if info.IsDir() && !recursive && len(relSecs) >= len(patSecs) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, os.ErrNotExist
+	}
+	return matched, err
+}
+
+// globBase returns the static directory prefix of glob pattern, matched paths are copied relative to it,
+// it's parent directory for non-glob path.
+func globBase(pattern string) string {
+	secs := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, sec := range secs {
+		if hasGlobMeta(sec) {
+			base := strings.Join(secs[:i], "/")
+			if base == "" && i > 0 {
+				base = "/"
+			}
+			if base == "" {
+				base = "."
+			}
+			return base
+		}
+	}
+	return path.Dir(strings.TrimSuffix(filepath.ToSlash(pattern), "/"))
+}
+
+// copyGlobPaths copies paths matched by text block of glob patterns into dst directory,
+// keeping paths relative to the static prefix of patterns. every pattern must match at least one path.
+func copyGlobPaths(dst, patterns string, opts copyOptions) (copyStats, error) {
+	var stats copyStats
+	for _, pattern := range splitBlocks(patterns) {
+		var matched []string
+		_, err := os.Lstat(pattern)
+		literal := err == nil || !hasGlobMeta(pattern)
+		if literal {
+			if err == nil {
+				matched = []string{pattern}
+			}
+		} else {
+			m, err := globPath(pattern)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return stats, fmt.Errorf("glob path failed: %s, %w", pattern, err)
+			}
+			matched = m
+		}
+		if len(matched) == 0 {
+			return stats, fmt.Errorf("no source path matched: %s", pattern)
+		}
+		sort.Strings(matched)
+
+		base := globBase(pattern)
+		if literal {
+			base = path.Dir(strings.TrimSuffix(filepath.ToSlash(pattern), "/"))
+		}
+		var copiedDirs []string
+	Matched:
+		for _, m := range matched {
+			relPath, err := filepath.Rel(base, m)
+			if err != nil {
+				return stats, err
+			}
+			relPath = filepath.ToSlash(relPath)
+			// children of copied directories are matched by '**'
+			for _, d := range copiedDirs {
+				if strings.HasPrefix(relPath, d+"/") {
+					continue Matched
+				}
+			}
+			stat, err := os.Stat(m)
+			isDir := err == nil && stat.IsDir()
+			skip, err := opts.skipped(relPath, isDir)
+			if err != nil {
+				return stats, err
+			}
+			if skip {
+				continue
+			}
+			// children of matched directories are filtered relative to the static prefix too
+			subOpts := opts
+			subOpts.prefix = relPath
+			var s copyStats
+			if opts.sync {
+				s, err = syncPath(filepath.Join(dst, relPath), m, subOpts)
+			} else {
+				s, err = copyPath(filepath.Join(dst, relPath), m, subOpts)
+			}
+			stats.add(s)
+			if err != nil {
+				return stats, fmt.Errorf("copy path failed: %s, %w", m, err)
+			}
+			if isDir {
+				copiedDirs = append(copiedDirs, relPath)
+			}
+		}
+	}
+	return stats, nil
+}
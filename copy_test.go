@@ -0,0 +1,289 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGlobPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"file1.txt", "file2.txt", "file10.txt", "file[1].txt", "dir/a.conf", "dir/b.conf", "dir/c.conf", "dir/sub/a.conf"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(name), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := filepath.ToSlash(dir)
+
+	cases := []struct {
+		pattern string
+		want    []string
+		glob    bool
+	}{
+		{"file?.txt", []string{"file1.txt", "file2.txt"}, true},
+		{"file??.txt", []string{"file10.txt"}, true},
+		{"file[12].txt", []string{"file1.txt", "file2.txt"}, true},
+		{"file[^1].txt", []string{"file2.txt"}, true},
+		{"dir/[ab].conf", []string{"dir/a.conf", "dir/b.conf"}, true},
+		{"d?r/*.conf", []string{"dir/a.conf", "dir/b.conf", "dir/c.conf"}, true},
+		{"dir/**/[a].conf", []string{"dir/a.conf", "dir/sub/a.conf"}, true},
+		{"*.txt", []string{"file1.txt", "file10.txt", "file2.txt", "file[1].txt"}, true},
+		{"file[1].txt", []string{"file[1].txt"}, false},
+		{"file1.txt", []string{"file1.txt"}, false},
+		{"file[3].txt", nil, true},
+		{"missing/file?.txt", nil, true},
+	}
+	for _, c := range cases {
+		pattern := root + "/" + c.pattern
+		if isGlobPattern(pattern) != c.glob {
+			t.Errorf("%s: want glob pattern %v", c.pattern, c.glob)
+		}
+		matched, err := globPath(pattern)
+		if err != nil && !os.IsNotExist(err) {
+			t.Errorf("glob %s failed: %v", c.pattern, err)
+			continue
+		}
+		var got []string
+		for _, m := range matched {
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("glob %s: want %v, got %v", c.pattern, c.want, got)
+		}
+	}
+}
+
+// writeTestTree creates files with content under root, names are slash separated.
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listTestTree returns sorted slash separated paths of files under root, directories end with '/'.
+func listTestTree(t *testing.T, root string) []string {
+	var names []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			rel += "/"
+		}
+		names = append(names, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCopyGlobPathsFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, filepath.Join(dir, "assets"), map[string]string{
+		"index.html":        "index",
+		"img/a.png":         "a",
+		"img/cache/b.png":   "b",
+		"img/cache/c/d.png": "d",
+		"css/site.css":      "css",
+		"css/site.css.map":  "map",
+	})
+	cases := []struct {
+		exclude []string
+		include []string
+		want    []string
+	}{
+		{
+			exclude: []string{"img/cache/**"},
+			want:    []string{"css/", "css/site.css", "css/site.css.map", "img/", "img/a.png", "index.html"},
+		},
+		{
+			exclude: []string{"img/cache"},
+			want:    []string{"css/", "css/site.css", "css/site.css.map", "img/", "img/a.png", "index.html"},
+		},
+		{
+			exclude: []string{"*.map", "img/cache/c/**"},
+			want:    []string{"css/", "css/site.css", "img/", "img/a.png", "img/cache/", "img/cache/b.png", "index.html"},
+		},
+		{
+			include: []string{"img/**/*.png"},
+			want:    []string{"css/", "img/", "img/a.png", "img/cache/", "img/cache/b.png", "img/cache/c/", "img/cache/c/d.png"},
+		},
+	}
+	for i, c := range cases {
+		dst := filepath.Join(dir, "out", strconv.Itoa(i))
+		opts := copyOptions{exclude: c.exclude, include: c.include}
+		_, err := copyGlobPaths(dst, filepath.ToSlash(filepath.Join(dir, "assets"))+"/*", opts)
+		if err != nil {
+			t.Errorf("copy %v %v failed: %v", c.exclude, c.include, err)
+			continue
+		}
+		got := listTestTree(t, dst)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("copy exclude %v include %v:\nwant %v\ngot  %v", c.exclude, c.include, c.want, got)
+		}
+	}
+}
+
+func TestSyncPath(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	writeTestTree(t, src, map[string]string{
+		"a":   "1",
+		"d/b": "22",
+		"d/c": "333",
+	})
+	sync := func(desc string, opts copyOptions, want copyStats) {
+		t.Helper()
+		stats, err := syncPath(dst, src, opts)
+		if err != nil {
+			t.Fatalf("%s: sync failed: %v", desc, err)
+		}
+		if stats != want {
+			t.Errorf("%s: want %s, got %s", desc, want, stats)
+		}
+	}
+	readDst := func(name string) string {
+		t.Helper()
+		content, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+	setMtime := func(p string, mtime time.Time) {
+		t.Helper()
+		err := os.Chtimes(p, mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync("initial", copyOptions{}, copyStats{copied: 3})
+	sync("unchanged", copyOptions{}, copyStats{skipped: 3})
+
+	// same size, different mtime
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestTree(t, src, map[string]string{"a": "2"})
+	setMtime(filepath.Join(src, "a"), old)
+	sync("mtime changed", copyOptions{}, copyStats{copied: 1, skipped: 2})
+	if readDst("a") != "2" {
+		t.Errorf("changed file isn't copied")
+	}
+
+	// same size and mtime, different content
+	writeTestTree(t, dst, map[string]string{"a": "3"})
+	setMtime(filepath.Join(dst, "a"), old)
+	sync("content changed", copyOptions{}, copyStats{skipped: 3})
+	if readDst("a") != "3" {
+		t.Errorf("file with same size and mtime should be skipped")
+	}
+	sync("checksum", copyOptions{checksum: true}, copyStats{copied: 1, skipped: 2})
+	if readDst("a") != "2" {
+		t.Errorf("file with different content isn't copied in checksum mode")
+	}
+	// mtime is fixed for unchanged content
+	setMtime(filepath.Join(dst, "d/b"), old)
+	sync("checksum mtime", copyOptions{checksum: true}, copyStats{skipped: 3})
+	sync("mtime fixed", copyOptions{}, copyStats{skipped: 3})
+
+	writeTestTree(t, dst, map[string]string{
+		"extra":     "x",
+		"d/old":     "x",
+		"e/f":       "x",
+		"keep.log":  "x",
+		"d/new.log": "x",
+	})
+	sync("no delete", copyOptions{}, copyStats{skipped: 3})
+	want := []string{"a", "d/", "d/b", "d/c", "d/new.log", "d/old", "e/", "e/f", "extra", "keep.log"}
+	if got := listTestTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("no delete:\nwant %v\ngot  %v", want, got)
+	}
+	sync("delete", copyOptions{delete: true, exclude: []string{"*.log"}}, copyStats{skipped: 3, removed: 3})
+	want = []string{"a", "d/", "d/b", "d/c", "d/new.log", "keep.log"}
+	if got := listTestTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("delete with exclude:\nwant %v\ngot  %v", want, got)
+	}
+	sync("delete all", copyOptions{delete: true}, copyStats{skipped: 3, removed: 2})
+	want = []string{"a", "d/", "d/b", "d/c"}
+	if got := listTestTree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("delete:\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestCopyFilesParallel(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files["src/"+strconv.Itoa(i)] = strconv.Itoa(i * i)
+	}
+	writeTestTree(t, dir, files)
+	// existing read-only file is replaced
+	writeTestTree(t, dir, map[string]string{"dst/0": "old"})
+	err := os.Chmod(filepath.Join(dir, "dst/0"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inPlace := range []bool{false, true} {
+		var jobs []copyJob
+		for i := 0; i < 50; i++ {
+			name := strconv.Itoa(i)
+			jobs = append(jobs, copyJob{dst: filepath.Join(dir, "dst", name), src: filepath.Join(dir, "src", name)})
+		}
+		err = copyFilesParallel(jobs, inPlace)
+		if err != nil {
+			t.Fatalf("copy in place %v failed: %v", inPlace, err)
+		}
+		for i := 0; i < 50; i++ {
+			content, err := ioutil.ReadFile(filepath.Join(dir, "dst", strconv.Itoa(i)))
+			if err != nil || string(content) != strconv.Itoa(i*i) {
+				t.Errorf("copy in place %v: file %d: %q, %v", inPlace, i, content, err)
+			}
+		}
+
+		jobs = append(jobs, copyJob{dst: filepath.Join(dir, "dst", "missing"), src: filepath.Join(dir, "src", "missing")})
+		err = copyFilesParallel(jobs, inPlace)
+		if err == nil {
+			t.Errorf("copy in place %v: missing source file should be reported", inPlace)
+		}
+	}
+	err = copyFilesParallel(nil, false)
+	if err != nil {
+		t.Errorf("copy empty jobs failed: %v", err)
+	}
+}
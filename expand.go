@@ -3,86 +3,207 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/cosiner/argv"
 	"github.com/uiez/tash/syntax"
 )
 
+// envValue is string or list, list is joined by DefaultArraySeparator when it's interpolated into string.
+type envValue struct {
+	str    string
+	list   []string
+	isList bool
+}
+
+func stringValue(s string) envValue {
+	return envValue{str: s}
+}
+
+func listValue(l []string) envValue {
+	return envValue{list: l, isList: true}
+}
+
+func (v envValue) String() string {
+	if v.isList {
+		return strings.Join(v.list, syntax.DefaultArraySeparator)
+	}
+	return v.str
+}
+
+// elements returns copy of list elements, or elements split from string by separator.
+func (v envValue) elements(sep string) []string {
+	if v.isList {
+		return append([]string(nil), v.list...)
+	}
+	if sep == "" {
+		sep = syntax.DefaultArraySeparator
+	}
+	return stringSplitAndTrimFilterSpace(v.str, sep)
+}
+
+// envAttr is attribute flags of env, they are kept on reassignment.
+type envAttr uint8
+
+const (
+	// visible to expanding, but not exported to child processes
+	envLocal envAttr = 1 << iota
+	// reassignment and unset are not allowed
+	envReadonly
+)
+
 type ExpandEnvs struct {
-	envs map[string]string
+	envs  map[string]envValue
+	attrs map[string]envAttr
+
+	// user defined filters
+	filters map[string]syntax.ExpandFilter
+	// user defined filters being called, to detect recursive definitions
+	filterStack []string
 }
 
 func newExpandEnvs() *ExpandEnvs {
 	vars := &ExpandEnvs{
-		envs: make(map[string]string),
+		envs:  make(map[string]envValue),
+		attrs: make(map[string]envAttr),
 	}
 
 	return vars
 }
 func (e *ExpandEnvs) copy() *ExpandEnvs {
 	ne := ExpandEnvs{
-		envs: make(map[string]string),
+		envs:        make(map[string]envValue),
+		attrs:       make(map[string]envAttr),
+		filters:     e.filters,
+		filterStack: e.filterStack,
 	}
 	for k, v := range e.envs {
 		ne.envs[k] = v
 	}
+	for k, a := range e.attrs {
+		ne.attrs[k] = a
+	}
 	return &ne
 }
 
 func (e *ExpandEnvs) remove(k string) {
 	delete(e.envs, k)
+	delete(e.attrs, k)
+}
+
+// unset removes env, PATH is also removed from process environments as it's used to lookup executables.
+func (e *ExpandEnvs) unset(k string) error {
+	if e.isReadonly(k) {
+		return fmt.Errorf("env is readonly: %s", k)
+	}
+	e.remove(k)
+	if k == "PATH" {
+		os.Unsetenv(k)
+	}
+	return nil
+}
+
+func (e *ExpandEnvs) isReadonly(k string) bool {
+	return e.attrs[k]&envReadonly != 0
 }
 
 func (e *ExpandEnvs) get(k string) (string, bool) {
+	v, has := e.envs[k]
+	return v.String(), has
+}
+
+func (e *ExpandEnvs) getValue(k string) (envValue, bool) {
 	v, has := e.envs[k]
 	return v, has
 }
 
-func (e *ExpandEnvs) set(k, v string) {
+func (e *ExpandEnvs) set(k, v string) error {
+	return e.setValue(k, stringValue(v))
+}
+
+func (e *ExpandEnvs) setValue(k string, v envValue) error {
+	if e.isReadonly(k) {
+		return fmt.Errorf("env is readonly: %s", k)
+	}
 	e.envs[k] = v
 	if k == "PATH" {
-		os.Setenv(k, v)
+		os.Setenv(k, v.String())
 	}
+	return nil
 }
-func (e *ExpandEnvs) addAndExpand(log logger, k, v string, expand bool) {
+
+func (e *ExpandEnvs) addAndExpand(log logger, k, v string, expand bool) bool {
+	val := stringValue(v)
 	if expand {
-		err := e.expandStringPtrs(&v)
+		expanded, err := e.expandValue(v)
 		if err != nil {
-			log.fatalln(err)
+			log.fatalln(fmt.Errorf("expand string failed: %s, %w", v, err))
+		} else {
+			val = expanded
 		}
 	}
+	return e.addValue(log, k, val)
+}
 
-	log.debugln("env add:", k, v)
-	e.set(k, v)
+func (e *ExpandEnvs) addValue(log logger, k string, v envValue) bool {
+	err := e.setValue(k, v)
+	if err != nil {
+		log.fatalln(err)
+		return false
+	}
+	log.debugln("env add:", k, v.String())
+	return true
 }
 
-func (e *ExpandEnvs) parseEnv(log indentLogger, envs syntax.EnvList) {
+// parseEnv adds envs with attributes, for local and readonly block,
+// entry without value changes attributes of existing env, such as secrets from system environments.
+func (e *ExpandEnvs) parseEnv(log logger, envs syntax.EnvList, attr envAttr) {
 	for _, env := range envs.Envs() {
 		blocks := splitBlocks(env)
-		e.parsePairs(log, blocks, true)
+		for _, item := range blocks {
+			if attr != 0 && item != "" && !strings.Contains(item, "=") {
+				if !e.Exist(item) {
+					log.fatalln("env not defined:", item)
+					return
+				}
+				e.attrs[item] |= attr
+				continue
+			}
+			k, ok := e.parsePair(log, item, true)
+			if ok {
+				e.attrs[k] |= attr
+			}
+		}
 	}
 }
 
 func (e *ExpandEnvs) parsePairs(log logger, items []string, expand bool) {
 	for _, item := range items {
-		if item == "" {
-			continue
-		}
-		k, v := stringSplitAndTrimToPair(item, "=")
-		if k == "" || v == "" {
-			continue
-		}
-		v = stringUnquote(v)
+		e.parsePair(log, item, expand)
+	}
+}
 
-		e.addAndExpand(log, k, v, expand)
+func (e *ExpandEnvs) parsePair(log logger, item string, expand bool) (string, bool) {
+	if item == "" {
+		return "", false
 	}
+	k, v := stringSplitAndTrimToPair(item, "=")
+	if k == "" || v == "" {
+		return "", false
+	}
+	v = stringUnquote(v)
+
+	return k, e.addAndExpand(log, k, v, expand)
 }
 
+// formatEnvs returns exported envs.
 func (e *ExpandEnvs) formatEnvs() []string {
 	var items []string
 	for k, v := range e.envs {
-		items = append(items, k+"="+v)
+		if e.attrs[k]&envLocal != 0 {
+			continue
+		}
+		items = append(items, k+"="+v.String())
 	}
 	return items
 }
@@ -126,185 +247,222 @@ func (e *ExpandEnvs) trimSpaceIfUnquoted(s string) string {
 }
 
 func (e *ExpandEnvs) lookupAndFilter(name string, filters []string) (string, error) {
-	var val string
-	if us := stringUnquote(name); us != name {
-		if strings.Contains(us, "$") {
-			var err error
-			val, err = e.expandString(us)
-			if err != nil {
-				return "", fmt.Errorf("expand failed: `%s`, %w", us, err)
-			}
-		} else {
-			val = us
+	v, err := newExpansionVar(0, name, filters).eval(e)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func (e *ExpandEnvs) applyFilters(val envValue, filters []*expansionFilter) (envValue, error) {
+	for _, f := range filters {
+		var err error
+		val, err = f.eval(e, val)
+		if err != nil {
+			return envValue{}, err
 		}
+	}
+	return val, nil
+}
+
+// callFilter searches list filters, string filters and user defined filters in order,
+// list value is joined for string filters.
+func (e *ExpandEnvs) callFilter(source string, val envValue, args []string) (envValue, error) {
+	var (
+		res envValue
+		err error
+	)
+	if listFilter, has := expandListFilters[args[0]]; has {
+		res, err = listFilter(val, args[1:], e)
+	} else if filterFunc, has := expandFilters[args[0]]; has {
+		var s string
+		s, err = filterFunc(val.String(), args[1:], e)
+		res = stringValue(s)
+	} else if userFilter, has := e.filters[args[0]]; has {
+		res, err = e.runUserFilter(args[0], userFilter, val, args[1:])
 	} else {
-		val = e.envs[name]
+		return envValue{}, fmt.Errorf("unrecognized expand filter: %s", source)
+	}
+	if err != nil {
+		return envValue{}, fmt.Errorf("execute expand filter failed: %s, %w", source, err)
 	}
+	return res, nil
+}
 
-	for _, filter := range filters {
-		originFilter := filter
-		filter = stringUnquote(filter)
-		filter, err := e.expandString(filter)
-		if err != nil {
-			return "", fmt.Errorf("invalid expand filter: %s, %w", originFilter, err)
+func (e *ExpandEnvs) runUserFilter(name string, filter syntax.ExpandFilter, val envValue, args []string) (envValue, error) {
+	for i, n := range e.filterStack {
+		if n == name {
+			return envValue{}, fmt.Errorf("recursive filter definition: %s", strings.Join(append(e.filterStack[i:], name), " -> "))
 		}
+	}
+	e.filterStack = append(e.filterStack, name)
+	defer func() {
+		e.filterStack = e.filterStack[:len(e.filterStack)-1]
+	}()
 
-		argv, err := argv.Argv(filter, nil, func(s string) (string, error) {
-			return s, nil
-		})
+	if filter.Cmd != "" {
+		output, err := getCmdFilterOutput(e, filter.Cmd, args, val.String())
 		if err != nil {
-			return "", fmt.Errorf("invalid expand filter: %s, %w", originFilter, err)
+			return envValue{}, err
 		}
-		args := argv[0]
-		if len(argv) != 1 || len(args) == 0 {
-			return "", fmt.Errorf("invalid expand filter syntax: %s, %v", originFilter, argv)
+		return stringValue(output), nil
+	}
+
+	// args of outer filter aren't visible in pipeline
+	envs := e
+	if len(args) > 0 || e.hasPositionalArgs() {
+		envs = e.copy()
+		for k := range envs.envs {
+			if isPositionalArg(k) {
+				envs.remove(k)
+			}
 		}
-		filterFunc, has := expandFilters[args[0]]
-		if !has && syntax.IsValidOP(args[0]) {
-			args = append([]string{syntax.Ef_condition_check}, args...)
-			filterFunc, has = expandFilters[args[0]]
+		for i, arg := range args {
+			envs.envs[strconv.Itoa(i+1)] = stringValue(arg)
 		}
-		if !has {
-			return "", fmt.Errorf("unrecognized expand filter: %s", originFilter)
+	}
+	return envs.applyFilters(val, compileFilterPipeline(filter.Pipeline))
+}
+
+func (e *ExpandEnvs) hasPositionalArgs() bool {
+	for k := range e.envs {
+		if isPositionalArg(k) {
+			return true
 		}
-		val, err = filterFunc(val, args[1:], e)
-		if err != nil {
-			return "", fmt.Errorf("execute expand filter failed: %s, %w", originFilter, err)
+	}
+	return false
+}
+
+// isPositionalArg reports whether env name is user filter arg, such as '1', '2'.
+func isPositionalArg(k string) bool {
+	n, err := strconv.Atoi(k)
+	return err == nil && n > 0 && k[0] != '0' && k[0] != '+'
+}
+
+// splitFilterPipeline splits filters by '|' outside of quotes and braces.
+func splitFilterPipeline(s string) []string {
+	var (
+		filters []string
+		depth   int
+		quote   rune
+		start   int
+	)
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		switch c := rs[i]; {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == '|' && depth == 0:
+			filters = append(filters, strings.TrimSpace(string(rs[start:i])))
+			start = i + 1
 		}
 	}
-	return val, nil
+	filters = append(filters, strings.TrimSpace(string(rs[start:])))
+	return filters
 }
 
 func (e *ExpandEnvs) expandString(s string) (string, error) {
-	const (
-		statePlain = iota
-		stateVar
-		stateName
-		stateBlockName
-	)
-	var (
-		state = statePlain
+	return compileExpansion(s).eval(e)
+}
 
-		buf              []rune
-		nameBuf          []rune
-		nameBlockFilters []int
-		nameBlockDepth   int
+// expandValue keeps the list value if the whole string is a single variable, such as '${"*.go" | file.glob}'.
+func (e *ExpandEnvs) expandValue(s string) (envValue, error) {
+	return compileExpansion(s).evalValue(e)
+}
 
-		err error
+// expandCommand expands command line, list value which is an unquoted word is expanded to quoted elements,
+// so they are passed as separate arguments, such as 'rm $FILES', list in quotes or in word is quoted as one argument.
+func (e *ExpandEnvs) expandCommand(s string) (string, error) {
+	x := compileExpansion(s)
+	var (
+		sb    strings.Builder
+		quote rune
 	)
-	resolveVar := func() []rune {
-		var name string
-		var filters []string
-		if len(nameBlockFilters) > 0 {
-			for i := range nameBlockFilters {
-				if i == 0 {
-					name = string(nameBuf[:nameBlockFilters[i]])
-				} else {
-					filters = append(filters, string(nameBuf[nameBlockFilters[i-1]+1:nameBlockFilters[i]]))
-				}
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '|'
+	}
+	isWord := func(i int) bool {
+		if i > 0 {
+			prev := x.nodes[i-1]
+			if prev.variable != nil || !isSpace(prev.literal[len(prev.literal)-1]) {
+				return false
 			}
-			filters = append(filters, string(nameBuf[nameBlockFilters[len(nameBlockFilters)-1]+1:]))
-		} else {
-			name = string(nameBuf)
 		}
-		name = strings.TrimSpace(name)
-		for i := range filters {
-			filters[i] = strings.TrimSpace(filters[i])
+		if i < len(x.nodes)-1 {
+			next := x.nodes[i+1]
+			if next.variable != nil || !isSpace(next.literal[0]) {
+				return false
+			}
 		}
-		var v string
-		v, err = e.lookupAndFilter(name, filters)
-		return []rune(v)
+		return true
 	}
-	rs := []rune(s)
-	l := len(rs)
-	for i := 0; i < l; i++ {
-		switch state {
-		case statePlain:
-			switch rs[i] {
-			case '$':
-				state = stateVar
-				nameBuf = nameBuf[:0]
-				nameBlockFilters = nameBlockFilters[:0]
-				nameBlockDepth = 0
-			case '\\':
-				if i < l-1 {
-					i++
-					buf = append(buf, rs[i])
+	for i, n := range x.nodes {
+		if n.variable == nil {
+			for _, c := range n.literal {
+				switch {
+				case quote == 0 && (c == '\'' || c == '"'):
+					quote = c
+				case c == quote:
+					quote = 0
 				}
-			default:
-				buf = append(buf, rs[i])
-			}
-		case stateVar:
-			switch {
-			case rs[i] == '{':
-				state = stateBlockName
-			case isAlphaNum(rs[i]):
-				state = stateName
-				nameBuf = append(nameBuf, rs[i])
-			default:
-				state = statePlain
-				i--
 			}
-		case stateName:
-			switch {
-			case isAlphaNum(rs[i]):
-				nameBuf = append(nameBuf, rs[i])
-			default:
-				buf = append(buf, resolveVar()...)
-				if err != nil {
-					return "", err
-				}
-				state = statePlain
-				i--
+			sb.WriteString(n.literal)
+			continue
+		}
+		v, err := n.variable.eval(e)
+		if err != nil {
+			return "", &expandError{offset: n.variable.offset, err: err}
+		}
+		if !v.isList {
+			sb.WriteString(v.String())
+			continue
+		}
+		if quote != 0 || !isWord(i) {
+			// list joined in quotes or word is kept as single argument,
+			// the enclosing quote is closed and reopened around it.
+			if quote != 0 {
+				sb.WriteRune(quote)
 			}
-		case stateBlockName:
-			switch rs[i] {
-			case '\\':
-				nameBuf = append(nameBuf, rs[i])
-				if i < l-1 {
-					i++
-					nameBuf = append(nameBuf, rs[i])
-				}
-			case '{':
-				nameBuf = append(nameBuf, rs[i])
-				nameBlockDepth++
-			case '|':
-				nameBuf = append(nameBuf, rs[i])
-				if nameBlockDepth == 0 {
-					nameBlockFilters = append(nameBlockFilters, len(nameBuf)-1)
-				}
-			case '}':
-				if nameBlockDepth > 0 {
-					nameBuf = append(nameBuf, rs[i])
-					nameBlockDepth--
-				} else {
-					buf = append(buf, resolveVar()...)
-					if err != nil {
-						return "", err
-					}
-					state = statePlain
-				}
-			default:
-				nameBuf = append(nameBuf, rs[i])
+			sb.WriteString(shellQuote(v.String()))
+			if quote != 0 {
+				sb.WriteRune(quote)
 			}
+			continue
 		}
-	}
-	switch state {
-	case statePlain:
-	case stateVar:
-	case stateName:
-		if len(nameBuf) > 0 {
-			buf = append(buf, resolveVar()...)
-			if err != nil {
-				return "", err
+		for j, elem := range v.list {
+			if j > 0 {
+				sb.WriteByte(' ')
 			}
-		}
-	case stateBlockName:
-		if len(nameBuf) > 0 {
-			buf = append(buf, nameBuf...)
+			sb.WriteString(shellQuote(elem))
 		}
 	}
-	return string(buf), nil
+	return sb.String(), nil
+}
+
+// expandError records the character offset of the failed variable in expanding string
+type expandError struct {
+	offset int
+	err    error
+}
+
+func (e *expandError) Error() string {
+	return fmt.Sprintf("at offset %d: %s", e.offset, e.err)
+}
+
+func (e *expandError) Unwrap() error {
+	return e.err
 }
 
 // isAlphaNum reports whether the byte is an ASCII letter, number, or underscore
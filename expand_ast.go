@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cosiner/argv"
+	"github.com/uiez/tash/syntax"
+)
+
+// expansion is the compiled form of expanding string: sequence of literals and variables.
+type expansion struct {
+	nodes []expansionNode
+}
+
+type expansionNode struct {
+	literal  string
+	variable *expansionVar
+}
+
+// expansionVar is '$NAME' or '${NAME | filter...}', name could also be string literal.
+type expansionVar struct {
+	// character offset in source string
+	offset int
+
+	name string
+	// quoted string literal, nil if name is env name
+	literal *expansion
+
+	filters []*expansionFilter
+}
+
+type expansionFilter struct {
+	source string
+	// pre-parsed filter args if filter doesn't contains variables
+	args []string
+	// filter should be expanded and parsed on evaluation
+	dynamic *expansion
+	// filter syntax error, reported on evaluation
+	err error
+}
+
+// compiled expansions cache, keyed by source string.
+// it's reset when growing too large, such as dynamic filters in loops.
+type expansionCache struct {
+	mu    sync.Mutex
+	items map[string]interface{}
+}
+
+const expansionCacheLimit = 4096
+
+// load returns cached item or creates it, lock isn't held during creating because compiling is recursive.
+func (c *expansionCache) load(key string, create func() interface{}) interface{} {
+	c.mu.Lock()
+	v, has := c.items[key]
+	c.mu.Unlock()
+	if has {
+		return v
+	}
+
+	v = create()
+	c.mu.Lock()
+	if c.items == nil || len(c.items) >= expansionCacheLimit {
+		c.items = make(map[string]interface{})
+	}
+	c.items[key] = v
+	c.mu.Unlock()
+	return v
+}
+
+var (
+	expansions          expansionCache
+	expansionFilters    expansionCache
+	expansionFilterArgs expansionCache
+	expansionPipelines  expansionCache
+)
+
+func compileExpansion(s string) *expansion {
+	return expansions.load(s, func() interface{} {
+		return parseExpansion(s)
+	}).(*expansion)
+}
+
+func parseExpansion(s string) *expansion {
+	const (
+		statePlain = iota
+		stateVar
+		stateName
+		stateBlockName
+	)
+	var (
+		state = statePlain
+
+		exp              expansion
+		buf              []rune
+		nameBuf          []rune
+		nameBlockFilters []int
+		nameBlockDepth   int
+		varOffset        int
+	)
+	flushLiteral := func() {
+		if len(buf) > 0 {
+			exp.nodes = append(exp.nodes, expansionNode{literal: string(buf)})
+			buf = buf[:0]
+		}
+	}
+	addVar := func() {
+		var name string
+		var filters []string
+		if len(nameBlockFilters) > 0 {
+			for i := range nameBlockFilters {
+				if i == 0 {
+					name = string(nameBuf[:nameBlockFilters[i]])
+				} else {
+					filters = append(filters, string(nameBuf[nameBlockFilters[i-1]+1:nameBlockFilters[i]]))
+				}
+			}
+			filters = append(filters, string(nameBuf[nameBlockFilters[len(nameBlockFilters)-1]+1:]))
+		} else {
+			name = string(nameBuf)
+		}
+		flushLiteral()
+		exp.nodes = append(exp.nodes, expansionNode{variable: newExpansionVar(varOffset, name, filters)})
+	}
+	rs := []rune(s)
+	l := len(rs)
+	for i := 0; i < l; i++ {
+		switch state {
+		case statePlain:
+			switch rs[i] {
+			case '$':
+				state = stateVar
+				varOffset = i
+				nameBuf = nameBuf[:0]
+				nameBlockFilters = nameBlockFilters[:0]
+				nameBlockDepth = 0
+			case '\\':
+				if i < l-1 {
+					i++
+					buf = append(buf, rs[i])
+				}
+			default:
+				buf = append(buf, rs[i])
+			}
+		case stateVar:
+			switch {
+			case rs[i] == '{':
+				state = stateBlockName
+			case isAlphaNum(rs[i]):
+				state = stateName
+				nameBuf = append(nameBuf, rs[i])
+			default:
+				state = statePlain
+				i--
+			}
+		case stateName:
+			switch {
+			case isAlphaNum(rs[i]):
+				nameBuf = append(nameBuf, rs[i])
+			default:
+				addVar()
+				state = statePlain
+				i--
+			}
+		case stateBlockName:
+			switch rs[i] {
+			case '\\':
+				nameBuf = append(nameBuf, rs[i])
+				if i < l-1 {
+					i++
+					nameBuf = append(nameBuf, rs[i])
+				}
+			case '{':
+				nameBuf = append(nameBuf, rs[i])
+				nameBlockDepth++
+			case '|':
+				nameBuf = append(nameBuf, rs[i])
+				if nameBlockDepth == 0 {
+					nameBlockFilters = append(nameBlockFilters, len(nameBuf)-1)
+				}
+			case '}':
+				if nameBlockDepth > 0 {
+					nameBuf = append(nameBuf, rs[i])
+					nameBlockDepth--
+				} else {
+					addVar()
+					state = statePlain
+				}
+			default:
+				nameBuf = append(nameBuf, rs[i])
+			}
+		}
+	}
+	switch state {
+	case statePlain:
+	case stateVar:
+	case stateName:
+		if len(nameBuf) > 0 {
+			addVar()
+		}
+	case stateBlockName:
+		if len(nameBuf) > 0 {
+			buf = append(buf, nameBuf...)
+		}
+	}
+	flushLiteral()
+	return &exp
+}
+
+func newExpansionVar(offset int, name string, filters []string) *expansionVar {
+	v := expansionVar{
+		offset: offset,
+		name:   strings.TrimSpace(name),
+	}
+	if us := stringUnquote(v.name); us != v.name {
+		// literal without variables is kept verbatim, backslashes aren't escapes, such as regexp patterns.
+		if strings.Contains(us, "$") {
+			v.literal = compileExpansion(us)
+		} else {
+			v.literal = &expansion{nodes: []expansionNode{{literal: us}}}
+		}
+	}
+	for _, f := range filters {
+		v.filters = append(v.filters, compileFilter(strings.TrimSpace(f)))
+	}
+	return &v
+}
+
+func compileFilter(filter string) *expansionFilter {
+	return expansionFilters.load(filter, func() interface{} {
+		f := expansionFilter{source: filter}
+		exp := compileExpansion(stringUnquote(filter))
+		if text, ok := exp.static(); ok {
+			f.args, f.err = parseFilterArgs(filter, text)
+		} else {
+			f.dynamic = exp
+		}
+		return &f
+	}).(*expansionFilter)
+}
+
+// compileFilterPipeline compiles filters separated by '|' outside of quotes and braces.
+func compileFilterPipeline(pipeline string) []*expansionFilter {
+	return expansionPipelines.load(pipeline, func() interface{} {
+		var filters []*expansionFilter
+		for _, f := range splitFilterPipeline(pipeline) {
+			filters = append(filters, compileFilter(f))
+		}
+		return filters
+	}).([]*expansionFilter)
+}
+
+func parseFilterArgs(source, filter string) ([]string, error) {
+	argv, err := argv.Argv(filter, nil, func(s string) (string, error) {
+		return s, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid expand filter: %s, %w", source, err)
+	}
+	if len(argv) != 1 || len(argv[0]) == 0 {
+		return nil, fmt.Errorf("invalid expand filter syntax: %s, %v", source, argv)
+	}
+	args := argv[0]
+	if !isBuiltinFilter(args[0]) && syntax.IsValidOP(args[0]) {
+		args = append([]string{syntax.Ef_condition_check}, args...)
+	}
+	return args, nil
+}
+
+// static returns the content if there are no variables.
+func (x *expansion) static() (string, bool) {
+	switch len(x.nodes) {
+	case 0:
+		return "", true
+	case 1:
+		if x.nodes[0].variable == nil {
+			return x.nodes[0].literal, true
+		}
+	}
+	return "", false
+}
+
+func (x *expansion) eval(e *ExpandEnvs) (string, error) {
+	if s, ok := x.static(); ok {
+		return s, nil
+	}
+	var sb strings.Builder
+	for _, n := range x.nodes {
+		if n.variable == nil {
+			sb.WriteString(n.literal)
+			continue
+		}
+		v, err := n.variable.eval(e)
+		if err != nil {
+			return "", &expandError{offset: n.variable.offset, err: err}
+		}
+		sb.WriteString(v.String())
+	}
+	return sb.String(), nil
+}
+
+// evalValue returns the typed value if expansion is a single variable, otherwise the string.
+func (x *expansion) evalValue(e *ExpandEnvs) (envValue, error) {
+	if len(x.nodes) == 1 && x.nodes[0].variable != nil {
+		v, err := x.nodes[0].variable.eval(e)
+		if err != nil {
+			return envValue{}, &expandError{offset: x.nodes[0].variable.offset, err: err}
+		}
+		return v, nil
+	}
+	s, err := x.eval(e)
+	if err != nil {
+		return envValue{}, err
+	}
+	return stringValue(s), nil
+}
+
+func (v *expansionVar) eval(e *ExpandEnvs) (envValue, error) {
+	var val envValue
+	if v.literal != nil {
+		var err error
+		val, err = v.literal.evalValue(e)
+		if err != nil {
+			return envValue{}, fmt.Errorf("expand failed: `%s`, %w", stringUnquote(v.name), err)
+		}
+	} else {
+		val = e.envs[v.name]
+	}
+	return e.applyFilters(val, v.filters)
+}
+
+func (f *expansionFilter) eval(e *ExpandEnvs, val envValue) (envValue, error) {
+	if f.err != nil {
+		return envValue{}, f.err
+	}
+	args := f.args
+	if f.dynamic != nil {
+		filter, err := f.dynamic.eval(e)
+		if err != nil {
+			return envValue{}, fmt.Errorf("invalid expand filter: %s, %w", f.source, err)
+		}
+		parsed := expansionFilterArgs.load(filter, func() interface{} {
+			var p expansionFilter
+			p.args, p.err = parseFilterArgs(f.source, filter)
+			return &p
+		}).(*expansionFilter)
+		if parsed.err != nil {
+			return envValue{}, parsed.err
+		}
+		args = parsed.args
+	}
+	return e.callFilter(f.source, val, args)
+}
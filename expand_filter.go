@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -11,9 +16,11 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mattn/go-zglob"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 	"github.com/uiez/tash/syntax"
 )
 
@@ -59,20 +66,29 @@ func parseRange(l int, args []string) (start, end int, err error) {
 
 var expandFilters = map[string]func(val string, args []string, envs *ExpandEnvs) (string, error){}
 
+// expandListFilters accept and return typed value, such as filters of array, they don't need re-splitting list values.
+var expandListFilters = map[string]func(val envValue, args []string, envs *ExpandEnvs) (envValue, error){}
+
+func isBuiltinFilter(name string) bool {
+	_, isStringFilter := expandFilters[name]
+	_, isListFilter := expandListFilters[name]
+	return isStringFilter || isListFilter
+}
+
 func init() {
-	expandFilters[syntax.Ef_var_resolve] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_var_resolve] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		if len(args) != 0 {
-			return "", fmt.Errorf("args not needed")
+			return envValue{}, fmt.Errorf("args not needed")
 		}
-		val, _ = envs.get(val)
+		val, _ = envs.getValue(val.String())
 		return val, nil
 	}
-	expandFilters[syntax.Ef_string_default] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_string_default] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		if len(args) != 1 {
-			return "", fmt.Errorf("invalid args")
+			return envValue{}, fmt.Errorf("invalid args")
 		}
-		if val == "" {
-			return args[0], nil
+		if val.String() == "" {
+			return stringValue(args[0]), nil
 		}
 		return val, nil
 	}
@@ -168,6 +184,101 @@ func init() {
 		idx := strings.LastIndex(val, args[0])
 		return strconv.Itoa(idx), nil
 	}
+	expandFilters[syntax.Ef_string_format] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) == 0 {
+			return "", fmt.Errorf("args invalid")
+		}
+		return formatString(args[0], append([]string{val}, args[1:]...))
+	}
+	expandFilters[syntax.Ef_string_pad] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return "", fmt.Errorf("args invalid")
+		}
+		width, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid width: %s", args[1])
+		}
+		pad := " "
+		if len(args) == 3 {
+			if utf8.RuneCountInString(args[2]) != 1 {
+				return "", fmt.Errorf("pad character should be single character: %s", args[2])
+			}
+			pad = args[2]
+		}
+		n := width - utf8.RuneCountInString(val)
+		if n <= 0 {
+			return val, nil
+		}
+		switch args[0] {
+		case "left":
+			return strings.Repeat(pad, n) + val, nil
+		case "right":
+			return val + strings.Repeat(pad, n), nil
+		default:
+			return "", fmt.Errorf("invalid pad direction: %s", args[0])
+		}
+	}
+	expandFilters[syntax.Ef_string_repeat] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return "", fmt.Errorf("args invalid")
+		}
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 0 {
+			return "", fmt.Errorf("invalid count: %s", args[0])
+		}
+		var sep string
+		if len(args) == 2 {
+			sep = args[1]
+		}
+		vals := make([]string, count)
+		for i := range vals {
+			vals[i] = val
+		}
+		return strings.Join(vals, sep), nil
+	}
+	expandListFilters[syntax.Ef_string_split] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		if len(args) != 1 {
+			return envValue{}, fmt.Errorf("args invalid")
+		}
+		return listValue(stringSplitAndTrimFilterSpace(val.String(), args[0])), nil
+	}
+	expandFilters[syntax.Ef_string_match] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return "", fmt.Errorf("args invalid")
+		}
+		r, err := regexp.CompilePOSIX(args[0])
+		if err != nil {
+			return "", fmt.Errorf("compile regexp failed: %s, %w", args[0], err)
+		}
+		var group int
+		if len(args) == 2 {
+			group, err = strconv.Atoi(args[1])
+			if err != nil || group < 0 || group > r.NumSubexp() {
+				return "", fmt.Errorf("invalid group index: %s", args[1])
+			}
+		}
+		matches := r.FindStringSubmatch(val)
+		if matches == nil {
+			return "", nil
+		}
+		return matches[group], nil
+	}
+	expandFilters[syntax.Ef_lines_grep] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		r, err := regexp.CompilePOSIX(args[0])
+		if err != nil {
+			return "", fmt.Errorf("compile regexp failed: %s, %w", args[0], err)
+		}
+		var lines []string
+		for _, line := range strings.Split(val, "\n") {
+			if r.MatchString(line) {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	}
 
 	expandFilters[syntax.Ef_number_calc] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
 		if len(args) != 2 {
@@ -205,6 +316,16 @@ func init() {
 		}
 		return strconv.Itoa(n), nil
 	}
+	expandFilters[syntax.Ef_math_eval] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		n, err := evalMathExpr(val, envs.get)
+		if err != nil {
+			return "", fmt.Errorf("evaluate expression failed: %s, %w", val, err)
+		}
+		return n.String(), nil
+	}
 
 	expandFilters[syntax.Ef_condition_check] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
 		var (
@@ -254,32 +375,36 @@ func init() {
 	}
 	expandFilters[syntax.Ef_condition_select_alias] = expandFilters[syntax.Ef_condition_select]
 
-	withArray := func(val string, args []string, fn func(arr []string) ([]string, error)) (string, error) {
+	// withArray operates on list elements or elements split from string by separator,
+	// the result has the same type as input.
+	withArray := func(val envValue, args []string, fn func(arr []string) ([]string, error)) (envValue, error) {
 		var sep string
 		switch len(args) {
 		case 0:
 		case 1:
-			sep = args[1]
+			sep = args[0]
 		default:
-			return "", fmt.Errorf("args invalid")
+			return envValue{}, fmt.Errorf("args invalid")
 		}
 		if sep == "" {
 			sep = syntax.DefaultArraySeparator
 		}
-		arr := stringSplitAndTrimFilterSpace(val, sep)
-		arr, err := fn(arr)
+		arr, err := fn(val.elements(sep))
 		if err != nil {
-			return "", err
+			return envValue{}, err
+		}
+		if val.isList {
+			return listValue(arr), nil
 		}
-		return strings.Join(arr, sep), nil
+		return stringValue(strings.Join(arr, sep)), nil
 	}
-	expandFilters[syntax.Ef_array_sort] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_sort] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		return withArray(val, args, func(arr []string) ([]string, error) {
 			sort.Strings(arr)
 			return arr, nil
 		})
 	}
-	expandFilters[syntax.Ef_array_numSort] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_numSort] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		return withArray(val, args, func(arr []string) ([]string, error) {
 			nums := make([]int64, len(arr))
 			for i := range arr {
@@ -300,7 +425,7 @@ func init() {
 			return arr, nil
 		})
 	}
-	expandFilters[syntax.Ef_array_reverse] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_reverse] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		return withArray(val, args, func(arr []string) ([]string, error) {
 			l := len(arr)
 			for i := 0; i < l/2; i++ {
@@ -309,18 +434,65 @@ func init() {
 			return arr, nil
 		})
 	}
+	expandListFilters[syntax.Ef_array_unique] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		return withArray(val, args, func(arr []string) ([]string, error) {
+			seen := make(map[string]bool)
+			var end int
+			for _, s := range arr {
+				if !seen[s] {
+					seen[s] = true
+					arr[end] = s
+					end++
+				}
+			}
+			return arr[:end], nil
+		})
+	}
+	expandListFilters[syntax.Ef_array_map] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		if len(args) == 0 {
+			return envValue{}, fmt.Errorf("args invalid")
+		}
+		filters := compileFilterPipeline(args[0])
+		return withArray(val, args[1:], func(arr []string) ([]string, error) {
+			for i := range arr {
+				v, err := envs.applyFilters(stringValue(arr[i]), filters)
+				if err != nil {
+					return nil, err
+				}
+				arr[i] = v.String()
+			}
+			return arr, nil
+		})
+	}
+	expandListFilters[syntax.Ef_array_len] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		var count int
+		_, err := withArray(val, args, func(arr []string) ([]string, error) {
+			count = len(arr)
+			return arr, nil
+		})
+		if err != nil {
+			return envValue{}, err
+		}
+		return stringValue(strconv.Itoa(count)), nil
+	}
+	expandListFilters[syntax.Ef_array_join] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		if len(args) != 1 {
+			return envValue{}, fmt.Errorf("args invalid")
+		}
+		arr := val.elements(syntax.DefaultArraySeparator)
+		return stringValue(strings.Join(arr, args[0])), nil
+	}
 
-	expandFilters[syntax.Ef_array_get] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_get] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		if len(args) != 1 {
-			return "", fmt.Errorf("args invalid")
+			return envValue{}, fmt.Errorf("args invalid")
 		}
 
-		sep := syntax.DefaultArraySeparator
 		index := args[0]
-		arr := stringSplitAndTrimFilterSpace(val, sep)
+		arr := val.elements(syntax.DefaultArraySeparator)
 		eleIdx, err := strconv.Atoi(index)
 		if err != nil {
-			return "", fmt.Errorf("convert element index to number failed: '%s'", index)
+			return envValue{}, fmt.Errorf("convert element index to number failed: '%s'", index)
 		}
 		if eleIdx < 0 {
 			eleIdx = len(arr) + eleIdx
@@ -328,11 +500,11 @@ func init() {
 
 		valid := eleIdx >= 0 && eleIdx < len(arr)
 		if valid {
-			return arr[eleIdx], nil
+			return stringValue(arr[eleIdx]), nil
 		}
-		return "", nil
+		return stringValue(""), nil
 	}
-	expandFilters[syntax.Ef_array_slice] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_slice] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		var sep string
 		var rangeArgs []string
 		switch len(args) {
@@ -343,17 +515,20 @@ func init() {
 			sep = args[0]
 			rangeArgs = args[1:]
 		default:
-			return "", fmt.Errorf("args invalid")
+			return envValue{}, fmt.Errorf("args invalid")
 		}
-		arr := stringSplitAndTrimFilterSpace(val, sep)
+		arr := val.elements(sep)
 		start, end, err := parseRange(len(arr), rangeArgs)
 		if err != nil {
-			return "", err
+			return envValue{}, err
 		}
 		arr = arr[start:end]
-		return strings.Join(arr, sep), nil
+		if val.isList {
+			return listValue(arr), nil
+		}
+		return stringValue(strings.Join(arr, sep)), nil
 	}
-	expandFilters[syntax.Ef_array_separator] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_separator] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		var oldSep string
 		var newSep string
 		switch len(args) {
@@ -364,62 +539,130 @@ func init() {
 			oldSep = args[0]
 			newSep = args[1]
 		default:
-			return "", fmt.Errorf("args invalid")
+			return envValue{}, fmt.Errorf("args invalid")
 		}
 
-		arr := stringSplitAndTrimFilterSpace(val, oldSep)
-		return strings.Join(arr, newSep), nil
+		arr := val.elements(oldSep)
+		return stringValue(strings.Join(arr, newSep)), nil
 	}
-	expandFilters[syntax.Ef_array_filter] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_filter] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		var compare *string
 		switch len(args) {
 		case 1:
 		case 2:
 			compare = &args[1]
 		default:
-			return "", fmt.Errorf("args invalid")
+			return envValue{}, fmt.Errorf("args invalid")
 		}
 		operator := args[0]
-		arr := stringSplitAndTrimFilterSpace(val, syntax.DefaultArraySeparator)
-		var end int
-		for i, s := range arr {
-			ok, err := checkCondition(envs, s, operator, compare)
-			if err != nil {
-				return "", err
-			}
-			if ok {
-				if end != i {
-					arr[end] = arr[i]
+		return withArray(val, nil, func(arr []string) ([]string, error) {
+			var end int
+			for i, s := range arr {
+				ok, err := checkCondition(envs, s, operator, compare)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					if end != i {
+						arr[end] = arr[i]
+					}
+					end++
 				}
-				end++
 			}
-		}
-		arr = arr[:end]
-		return strings.Join(arr, syntax.DefaultArraySeparator), nil
+			return arr[:end], nil
+		})
 	}
-	expandFilters[syntax.Ef_array_index] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_index] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		if len(args) != 1 {
-			return "", fmt.Errorf("invalid args")
+			return envValue{}, fmt.Errorf("invalid args")
 		}
-		arr := stringSplitAndTrimFilterSpace(val, syntax.DefaultArraySeparator)
+		arr := val.elements(syntax.DefaultArraySeparator)
 		for i := range arr {
 			if arr[i] == args[0] {
-				return strconv.Itoa(i), nil
+				return stringValue(strconv.Itoa(i)), nil
 			}
 		}
-		return "-1", nil
+		return stringValue("-1"), nil
 	}
-	expandFilters[syntax.Ef_array_has] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	expandListFilters[syntax.Ef_array_has] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
 		if len(args) != 1 {
-			return "", fmt.Errorf("invalid args")
+			return envValue{}, fmt.Errorf("invalid args")
 		}
-		arr := stringSplitAndTrimFilterSpace(val, syntax.DefaultArraySeparator)
+		arr := val.elements(syntax.DefaultArraySeparator)
 		for i := range arr {
 			if arr[i] == args[0] {
-				return "true", nil
+				return stringValue("true"), nil
 			}
 		}
-		return "false", nil
+		return stringValue("false"), nil
+	}
+
+	withSemver := func(val string, args []string, fn func(v semver) (string, error)) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		v, err := parseSemver(val)
+		if err != nil {
+			return "", err
+		}
+		return fn(v)
+	}
+	expandFilters[syntax.Ef_semver_bump] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		v, err := parseSemver(val)
+		if err != nil {
+			return "", err
+		}
+		v, err = v.bump(args[0])
+		if err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	}
+	expandFilters[syntax.Ef_semver_major] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return withSemver(val, args, func(v semver) (string, error) {
+			return strconv.FormatUint(v.major, 10), nil
+		})
+	}
+	expandFilters[syntax.Ef_semver_minor] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return withSemver(val, args, func(v semver) (string, error) {
+			return strconv.FormatUint(v.minor, 10), nil
+		})
+	}
+	expandFilters[syntax.Ef_semver_patch] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return withSemver(val, args, func(v semver) (string, error) {
+			return strconv.FormatUint(v.patch, 10), nil
+		})
+	}
+	expandFilters[syntax.Ef_semver_prerelease] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return withSemver(val, args, func(v semver) (string, error) {
+			return strings.Join(v.prerelease, "."), nil
+		})
+	}
+	expandListFilters[syntax.Ef_semver_sort] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		return withArray(val, args, func(arr []string) ([]string, error) {
+			type version struct {
+				s string
+				v semver
+			}
+			versions := make([]version, len(arr))
+			for i := range arr {
+				v, err := parseSemver(arr[i])
+				if err != nil {
+					return nil, fmt.Errorf("parse version failed: '%s', %w", arr[i], err)
+				}
+				versions[i] = version{s: arr[i], v: v}
+			}
+			sort.SliceStable(versions, func(i, j int) bool {
+				return compareSemver(versions[i].v, versions[j].v) < 0
+			})
+			for i := range versions {
+				arr[i] = versions[i].s
+			}
+			return arr, nil
+		})
 	}
 
 	parseMap := func(val string, sepArgs []string) (map[string]string, string, error) {
@@ -484,7 +727,7 @@ func init() {
 		}
 		return strings.Join(vals, sep), nil
 	}
-	expandFilters[syntax.Ef_json_get] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+	jsonGet := func(val string, args []string) (string, error) {
 		if len(args) <= 0 || len(args) > 2 {
 			return "", fmt.Errorf("args invalid")
 		}
@@ -499,24 +742,101 @@ func init() {
 		}
 		return "", fmt.Errorf("key not exist")
 	}
-	expandFilters[syntax.Ef_file_glob] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
-		var sep string
-		switch len(args) {
-		case 0:
-		case 1:
-			sep = args[1]
-		default:
+	expandFilters[syntax.Ef_json_get] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return jsonGet(val, args)
+	}
+	withConvertedJson := func(format string) func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return func(val string, args []string, envs *ExpandEnvs) (string, error) {
+			content, err := convertToJson(format, []byte(val))
+			if err != nil {
+				return "", err
+			}
+			return jsonGet(content, args)
+		}
+	}
+	expandFilters[syntax.Ef_yaml_get] = withConvertedJson("yaml")
+	expandFilters[syntax.Ef_toml_get] = withConvertedJson("toml")
+	expandFilters[syntax.Ef_ini_get] = withConvertedJson("ini")
+	expandFilters[syntax.Ef_json_set] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) < 2 || len(args) > 3 {
 			return "", fmt.Errorf("args invalid")
 		}
-		if sep == "" {
-			sep = syntax.DefaultArraySeparator
+		if val == "" {
+			val = "{}"
+		} else if !gjson.Valid(val) {
+			return "", fmt.Errorf("invalid json document")
+		}
+		var err error
+		if len(args) == 3 {
+			if args[2] != "json" {
+				return "", fmt.Errorf("invalid value type: %s", args[2])
+			}
+			if !gjson.Valid(args[1]) {
+				return "", fmt.Errorf("invalid json value: %s", args[1])
+			}
+			val, err = sjson.SetRaw(val, args[0], args[1])
+		} else {
+			val, err = sjson.Set(val, args[0], args[1])
+		}
+		if err != nil {
+			return "", fmt.Errorf("set json value failed: %w", err)
+		}
+		return val, nil
+	}
+	expandFilters[syntax.Ef_json_delete] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
 		}
-		matched, err := zglob.Glob(val)
+		if !gjson.Valid(val) {
+			return "", fmt.Errorf("invalid json document")
+		}
+		val, err := sjson.Delete(val, args[0])
+		if err != nil {
+			return "", fmt.Errorf("delete json value failed: %w", err)
+		}
+		return val, nil
+	}
+	expandListFilters[syntax.Ef_json_keys] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		if len(args) > 1 {
+			return envValue{}, fmt.Errorf("args invalid")
+		}
+		if !gjson.Valid(val.String()) {
+			return envValue{}, fmt.Errorf("invalid json document")
+		}
+		res := gjson.Parse(val.String())
+		if len(args) == 1 {
+			res = res.Get(args[0])
+		}
+		var keys []string
+		switch {
+		case res.IsObject():
+			res.ForEach(func(key, _ gjson.Result) bool {
+				keys = append(keys, key.String())
+				return true
+			})
+		case res.IsArray():
+			for i := range res.Array() {
+				keys = append(keys, strconv.Itoa(i))
+			}
+		default:
+			return envValue{}, fmt.Errorf("value is not object or array")
+		}
+		return listValue(keys), nil
+	}
+	expandListFilters[syntax.Ef_file_glob] = func(val envValue, args []string, envs *ExpandEnvs) (envValue, error) {
+		if len(args) > 1 {
+			return envValue{}, fmt.Errorf("args invalid")
+		}
+		pattern := val.String()
+		matched, err := zglob.Glob(pattern)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			return "", fmt.Errorf("invalid file pattern: %s, %w", val, err)
+			return envValue{}, fmt.Errorf("invalid file pattern: %s, %w", pattern, err)
 		}
 		matched = sliceToSlash(matched)
-		return strings.Join(matched, sep), nil
+		if len(args) == 1 {
+			return stringValue(strings.Join(matched, args[0])), nil
+		}
+		return listValue(matched), nil
 	}
 	expandFilters[syntax.Ef_file_abspath] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
 		if len(args) != 0 {
@@ -574,6 +894,190 @@ func init() {
 		}
 		return string(content), nil
 	}
+	expandFilters[syntax.Ef_file_rel] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		base, err1 := filepath.Abs(args[0])
+		target, err2 := filepath.Abs(val)
+		if err1 != nil || err2 != nil {
+			return "", fmt.Errorf("get absolute path failed: %s, %s", args[0], val)
+		}
+		relpath, err := filepath.Rel(base, target)
+		if err != nil {
+			return "", fmt.Errorf("get relative path failed: %w", err)
+		}
+		return stringToSlash(relpath), nil
+	}
+	expandFilters[syntax.Ef_file_join] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) == 0 {
+			return "", fmt.Errorf("args invalid")
+		}
+		return stringToSlash(filepath.Join(append([]string{val}, args...)...)), nil
+	}
+	withFileStat := func(val string, fn func(stat os.FileInfo) string) (string, error) {
+		stat, err := os.Stat(val)
+		if err != nil {
+			return "", fmt.Errorf("retrieve file status failed: %w", err)
+		}
+		return fn(stat), nil
+	}
+	expandFilters[syntax.Ef_file_size] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		return withFileStat(val, func(stat os.FileInfo) string {
+			return strconv.FormatInt(stat.Size(), 10)
+		})
+	}
+	expandFilters[syntax.Ef_file_mtime] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) > 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		return withFileStat(val, func(stat os.FileInfo) string {
+			if len(args) == 0 {
+				return strconv.FormatInt(stat.ModTime().Unix(), 10)
+			}
+			return stat.ModTime().Format(args[0])
+		})
+	}
+	expandFilters[syntax.Ef_file_mode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		return withFileStat(val, func(stat os.FileInfo) string {
+			return fmt.Sprintf("%04o", stat.Mode().Perm())
+		})
+	}
+	expandFilters[syntax.Ef_file_lines] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		content, err := ioutil.ReadFile(val)
+		if err != nil {
+			return "", err
+		}
+		n := bytes.Count(content, []byte{'\n'})
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			n++
+		}
+		return strconv.Itoa(n), nil
+	}
+	expandFilters[syntax.Ef_file_readlink] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		target, err := os.Readlink(val)
+		if err != nil {
+			return "", err
+		}
+		return stringToSlash(target), nil
+	}
+	expandFilters[syntax.Ef_file_which] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		path, err := lookupExecutable(val)
+		if err != nil {
+			return "", err
+		}
+		return stringToSlash(path), nil
+	}
+	expandFilters[syntax.Ef_file_hash] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		return hashFile(args[0], val)
+	}
+	expandFilters[syntax.Ef_dir_hash] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("args invalid")
+		}
+		return hashDir(args[0], val)
+	}
+
+	hashString := func(alg string) func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		return func(val string, args []string, envs *ExpandEnvs) (string, error) {
+			if len(args) != 0 {
+				return "", fmt.Errorf("args is not needed")
+			}
+			h, err := newHasher(alg)
+			if err != nil {
+				return "", err
+			}
+			_, _ = io.WriteString(h, val)
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}
+	}
+	expandFilters[syntax.Ef_hash_md5] = hashString(syntax.ResourceHashAlgMD5)
+	expandFilters[syntax.Ef_hash_sha1] = hashString(syntax.ResourceHashAlgSha1)
+	expandFilters[syntax.Ef_hash_sha256] = hashString(syntax.ResourceHashAlgSha256)
+
+	expandFilters[syntax.Ef_base64_encode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		return base64.StdEncoding.EncodeToString([]byte(val)), nil
+	}
+	expandFilters[syntax.Ef_base64_decode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		content, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 string: %w", err)
+		}
+		return string(content), nil
+	}
+	expandFilters[syntax.Ef_hex_encode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		return hex.EncodeToString([]byte(val)), nil
+	}
+	expandFilters[syntax.Ef_hex_decode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("args is not needed")
+		}
+		content, err := hex.DecodeString(val)
+		if err != nil {
+			return "", fmt.Errorf("invalid hexadecimal string: %w", err)
+		}
+		return string(content), nil
+	}
+	urlEscaping := func(args []string) (bool, error) {
+		switch len(args) {
+		case 0:
+			return false, nil
+		case 1:
+			if args[0] != "path" {
+				return false, fmt.Errorf("unsupported escaping mode: %s", args[0])
+			}
+			return true, nil
+		default:
+			return false, fmt.Errorf("args invalid")
+		}
+	}
+	expandFilters[syntax.Ef_url_encode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		isPath, err := urlEscaping(args)
+		if err != nil {
+			return "", err
+		}
+		if isPath {
+			return url.PathEscape(val), nil
+		}
+		return url.QueryEscape(val), nil
+	}
+	expandFilters[syntax.Ef_url_decode] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
+		isPath, err := urlEscaping(args)
+		if err != nil {
+			return "", err
+		}
+		if isPath {
+			return url.PathUnescape(val)
+		}
+		return url.QueryUnescape(val)
+	}
 
 	expandFilters[syntax.Ef_date_now] = func(val string, args []string, envs *ExpandEnvs) (string, error) {
 		switch len(args) {
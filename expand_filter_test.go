@@ -0,0 +1,555 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uiez/tash/syntax"
+)
+
+type filterTestCase struct {
+	input string
+	args  []string
+	want  string
+	// error is expected
+	fail bool
+}
+
+func runFilterTests(t *testing.T, name string, cases []filterTestCase) {
+	for _, c := range cases {
+		e := newExpandEnvs()
+		args := append([]string{name}, c.args...)
+		got, err := e.callFilter(name, stringValue(c.input), args)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s %v on %q: want error, got %q", name, c.args, c.input, got.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v on %q failed: %v", name, c.args, c.input, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("%s %v on %q: want %q, got %q", name, c.args, c.input, c.want, got.String())
+		}
+	}
+}
+
+func TestJsonGetFilter(t *testing.T) {
+	doc := `{"name": "tash", "version": "1.2.0", "deps": [{"name": "a"}, {"name": "b"}], "tags": ["x", "y"]}`
+	runFilterTests(t, "json.get", []filterTestCase{
+		{input: doc, args: []string{"version"}, want: "1.2.0"},
+		{input: doc, args: []string{"deps.1.name"}, want: "b"},
+		{input: doc, args: []string{"tags.0"}, want: "x"},
+		{input: doc, args: []string{"tags.#"}, want: "2"},
+		{input: doc, args: []string{"missing"}, fail: true},
+		{input: doc, args: []string{"tags.5"}, fail: true},
+		{input: doc, args: []string{"missing", "default"}, want: "default"},
+		{input: "", args: []string{"version"}, fail: true},
+		{input: "{invalid", args: []string{"version"}, fail: true},
+		{input: doc, args: nil, fail: true},
+	})
+}
+
+func TestYamlGetFilter(t *testing.T) {
+	doc := `apiVersion: v2
+name: chart
+version: 0.1.0
+appVersion: "1.16"
+enabled: yes
+dependencies:
+  - name: redis
+    version: 17.0.0
+  - name: postgres
+`
+	runFilterTests(t, "yaml.get", []filterTestCase{
+		{input: doc, args: []string{"version"}, want: "0.1.0"},
+		{input: doc, args: []string{"appVersion"}, want: "1.16"},
+		{input: doc, args: []string{"enabled"}, want: "yes"},
+		{input: doc, args: []string{"dependencies.0.version"}, want: "17.0.0"},
+		{input: doc, args: []string{"dependencies.1.name"}, want: "postgres"},
+		{input: doc, args: []string{"dependencies.#"}, want: "2"},
+		{input: doc, args: []string{"dependencies.1.version"}, fail: true},
+		{input: doc, args: []string{"missing", "none"}, want: "none"},
+		{input: "", args: []string{"version"}, fail: true},
+		{input: "a: [1, 2", args: []string{"a"}, fail: true},
+	})
+}
+
+func TestTomlGetFilter(t *testing.T) {
+	doc := `[package]
+name = "tash"
+version = "0.3.1"
+authors = ["a", "b"]
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+
+[[bin]]
+name = "first"
+
+[[bin]]
+name = "second"
+`
+	runFilterTests(t, "toml.get", []filterTestCase{
+		{input: doc, args: []string{"package.version"}, want: "0.3.1"},
+		{input: doc, args: []string{"package.authors.1"}, want: "b"},
+		{input: doc, args: []string{"dependencies.serde.version"}, want: "1.0"},
+		{input: doc, args: []string{"dependencies.serde.features.0"}, want: "derive"},
+		{input: doc, args: []string{"bin.1.name"}, want: "second"},
+		{input: doc, args: []string{"package.missing"}, fail: true},
+		{input: doc, args: []string{"package.missing", "none"}, want: "none"},
+		{input: "[package\nname = 1", args: []string{"package.name"}, fail: true},
+	})
+}
+
+func TestIniGetFilter(t *testing.T) {
+	doc := `root = top
+; comment
+[metadata]
+name = tash
+version: 1.0.0
+
+[options]
+install_requires =
+    requests
+    pyyaml
+`
+	runFilterTests(t, "ini.get", []filterTestCase{
+		{input: doc, args: []string{"root"}, want: "top"},
+		{input: doc, args: []string{"metadata.name"}, want: "tash"},
+		{input: doc, args: []string{"metadata.version"}, want: "1.0.0"},
+		{input: doc, args: []string{"options.install_requires"}, want: "requests\npyyaml"},
+		{input: doc, args: []string{"metadata.missing"}, fail: true},
+		{input: doc, args: []string{"missing.key", "none"}, want: "none"},
+		{input: "[metadata\nname = tash", args: []string{"metadata.name"}, fail: true},
+	})
+}
+
+func TestJsonSetFilter(t *testing.T) {
+	runFilterTests(t, "json.set", []filterTestCase{
+		{input: `{"version":"1.0.0"}`, args: []string{"version", "1.1.0"}, want: `{"version":"1.1.0"}`},
+		{input: `{"a":{"b":1}}`, args: []string{"a.c", "x"}, want: `{"a":{"b":1,"c":"x"}}`},
+		{input: `{"list":[1,2]}`, args: []string{"list.1", "3", "json"}, want: `{"list":[1,3]}`},
+		{input: `{"list":[1,2]}`, args: []string{"list.-1", "3", "json"}, want: `{"list":[1,2,3]}`},
+		{input: "", args: []string{"a", "b"}, want: `{"a":"b"}`},
+		{input: `{}`, args: []string{"a", "[1,", "json"}, fail: true},
+		{input: `{}`, args: []string{"a", "1", "yaml"}, fail: true},
+		{input: `{invalid`, args: []string{"a", "b"}, fail: true},
+		{input: `{}`, args: []string{"a"}, fail: true},
+	})
+}
+
+func TestJsonDeleteFilter(t *testing.T) {
+	runFilterTests(t, "json.delete", []filterTestCase{
+		{input: `{"a":1,"b":2}`, args: []string{"a"}, want: `{"b":2}`},
+		{input: `{"list":[1,2,3]}`, args: []string{"list.1"}, want: `{"list":[1,3]}`},
+		{input: `{"a":1}`, args: []string{"missing"}, want: `{"a":1}`},
+		{input: `{invalid`, args: []string{"a"}, fail: true},
+		{input: `{"a":1}`, args: nil, fail: true},
+	})
+}
+
+func TestJsonKeysFilter(t *testing.T) {
+	runFilterTests(t, "json.keys", []filterTestCase{
+		{input: `{"b":1,"a":{"x":1,"y":2}}`, want: "b a"},
+		{input: `{"b":1,"a":{"x":1,"y":2}}`, args: []string{"a"}, want: "x y"},
+		{input: `{"list":["x","y","z"]}`, args: []string{"list"}, want: "0 1 2"},
+		{input: `{"a":1}`, args: []string{"a"}, fail: true},
+		{input: `{"a":1}`, args: []string{"missing"}, fail: true},
+		{input: `{invalid`, fail: true},
+	})
+}
+
+func TestStructuredFileFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"package.json": `{"name": "app", "version": "2.0.1", "files": ["dist", "lib"]}`,
+		"Chart.yaml":   "name: chart\nversion: 0.4.0\n",
+		"Cargo.toml":   "[package]\nversion = \"0.9.0\"\n",
+		"setup.cfg":    "[metadata]\nversion = 3.1\n",
+		"invalid.json": `{"version": `,
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := newExpandEnvs()
+	e.set("DIR", filepath.ToSlash(dir))
+	cases := []struct {
+		s    string
+		want string
+		fail bool
+	}{
+		{s: `${"$DIR/package.json" | file.content | json.get version}`, want: "2.0.1"},
+		{s: `${"$DIR/package.json" | file.content | json.get files.1}`, want: "lib"},
+		{s: `${"$DIR/Chart.yaml" | file.content | yaml.get version}`, want: "0.4.0"},
+		{s: `${"$DIR/Cargo.toml" | file.content | toml.get package.version}`, want: "0.9.0"},
+		{s: `${"$DIR/setup.cfg" | file.content | ini.get metadata.version}`, want: "3.1"},
+		{s: `${"$DIR/package.json" | file.content | json.set version 2.1.0 | json.get version}`, want: "2.1.0"},
+		{s: `${"$DIR/package.json" | file.content | json.keys}`, want: "name version files"},
+		{s: `${"$DIR/package.json" | file.content | json.get missing}`, fail: true},
+		{s: `${"$DIR/invalid.json" | file.content | json.keys}`, fail: true},
+		{s: `${"$DIR/missing.json" | file.content | json.get version}`, fail: true},
+	}
+	for _, c := range cases {
+		got, err := e.expandString(c.s)
+		if c.fail {
+			if err == nil {
+				t.Errorf("expand %s: want error, got %q", c.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expand %s failed: %v", c.s, err)
+			continue
+		}
+		if strings.TrimSpace(got) != c.want {
+			t.Errorf("expand %s: want %q, got %q", c.s, c.want, got)
+		}
+	}
+}
+
+func TestUserFilters(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		s    string
+		want string
+		err  string
+	}{
+		{s: `${V | up}`, want: "X-Y"},
+		{s: `${V | rep x z}`, want: "z-y"},
+		{s: `${V | rep x z | up}`, want: "Z-Y"},
+		{s: `${L | array.map up}`, want: "A B C"},
+		{s: `${L | array.map "rep b z"}`, want: "a z c"},
+		// args of outer filter are cleared for inner filter
+		{s: `${V | outer Z}`, want: "<>-y"},
+		{s: `${V | self}`, err: "recursive filter definition: self -> self"},
+		{s: `${V | a}`, err: "recursive filter definition: a -> b -> a"},
+		{s: `${V | c}`, err: "recursive filter definition: a -> b -> a"},
+		{s: `${V | cmd.upper}`, want: "X-Y"},
+		{s: `${V | cmd.echo a "b c"}`, want: "a b c"},
+		{s: `${V | cmd.pwd}`, want: dir},
+		{s: `${V | rep x $WORKDIR | cmd.cat}`, want: dir + "-y"},
+		{s: `${V | cmd.false}`, err: "execute expand filter failed: cmd.false"},
+	}
+	for _, c := range cases {
+		e := newExpandEnvs()
+		e.set("V", "x-y")
+		e.set(syntax.BUILTIN_ENV_WORKDIR, dir)
+		e.setValue("L", listValue([]string{"a", "b", "c"}))
+		e.filters = map[string]syntax.ExpandFilter{
+			"up":        {Pipeline: "string.transform upper"},
+			"rep":       {Pipeline: "string.transform replace $1 $2"},
+			"outer":     {Pipeline: "inner"},
+			"inner":     {Pipeline: `string.transform replace x "<$1>"`},
+			"self":      {Pipeline: "self"},
+			"a":         {Pipeline: "string.transform upper | b"},
+			"b":         {Pipeline: "a"},
+			"c":         {Pipeline: "a"},
+			"cmd.upper": {Cmd: "tr a-z A-Z"},
+			"cmd.echo":  {Cmd: "echo"},
+			"cmd.pwd":   {Cmd: "pwd"},
+			"cmd.cat":   {Cmd: "cat"},
+			"cmd.false": {Cmd: "false"},
+		}
+		got, err := e.expandString(c.s)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expand %s: want error %q, got %q, %v", c.s, c.err, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expand %s failed: %v", c.s, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("expand %s: want %q, got %q", c.s, c.want, got)
+		}
+		if len(e.filterStack) != 0 {
+			t.Errorf("expand %s: filter stack isn't cleared: %v", c.s, e.filterStack)
+		}
+	}
+}
+
+func TestHashFilters(t *testing.T) {
+	runFilterTests(t, "hash.md5", []filterTestCase{
+		{input: "abc", want: "900150983cd24fb0d6963f7d28e17f72"},
+		{input: "", want: "d41d8cd98f00b204e9800998ecf8427e"},
+		{input: "abc", args: []string{"x"}, fail: true},
+	})
+	runFilterTests(t, "hash.sha1", []filterTestCase{
+		{input: "abc", want: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+	})
+	runFilterTests(t, "hash.sha256", []filterTestCase{
+		{input: "abc", want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	})
+}
+
+func TestEncodingFilters(t *testing.T) {
+	runFilterTests(t, "base64.encode", []filterTestCase{
+		{input: "hello?", want: "aGVsbG8/"},
+		{input: "", want: ""},
+		{input: "a", args: []string{"x"}, fail: true},
+	})
+	runFilterTests(t, "base64.decode", []filterTestCase{
+		{input: "aGVsbG8/", want: "hello?"},
+		{input: "aGVsbG8", fail: true},
+		{input: "!!!!", fail: true},
+	})
+	runFilterTests(t, "hex.encode", []filterTestCase{
+		{input: "hi\n", want: "68690a"},
+	})
+	runFilterTests(t, "hex.decode", []filterTestCase{
+		{input: "68690A", want: "hi\n"},
+		{input: "686", fail: true},
+		{input: "zz", fail: true},
+	})
+	runFilterTests(t, "url.encode", []filterTestCase{
+		{input: "a b/c?d=e&f", want: "a+b%2Fc%3Fd%3De%26f"},
+		{input: "a b/c?d", args: []string{"path"}, want: "a%20b%2Fc%3Fd"},
+		{input: "a", args: []string{"x"}, fail: true},
+	})
+	runFilterTests(t, "url.decode", []filterTestCase{
+		{input: "a+b%2Fc", want: "a b/c"},
+		{input: "a+b%20c", args: []string{"path"}, want: "a+b c"},
+		{input: "%zz", fail: true},
+	})
+
+	inputs := []string{"", "plain", "a b+c/d?e=f&g#h", "\x00\xff\n", "中文 ✓", "%%20"}
+	pairs := []struct {
+		encode, decode string
+		args           []string
+	}{
+		{"base64.encode", "base64.decode", nil},
+		{"hex.encode", "hex.decode", nil},
+		{"url.encode", "url.decode", nil},
+		{"url.encode", "url.decode", []string{"path"}},
+	}
+	for _, p := range pairs {
+		for _, s := range inputs {
+			e := newExpandEnvs()
+			encoded, err := e.callFilter(p.encode, stringValue(s), append([]string{p.encode}, p.args...))
+			if err != nil {
+				t.Errorf("%s %q failed: %v", p.encode, s, err)
+				continue
+			}
+			decoded, err := e.callFilter(p.decode, encoded, append([]string{p.decode}, p.args...))
+			if err != nil {
+				t.Errorf("%s %q failed: %v", p.decode, encoded.String(), err)
+				continue
+			}
+			if decoded.String() != s {
+				t.Errorf("%s %v round trip: want %q, got %q", p.encode, p.args, s, decoded.String())
+			}
+		}
+	}
+}
+
+func TestFileHashFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"abc.txt": "abc", "empty": ""})
+	file := filepath.Join(dir, "abc.txt")
+	runFilterTests(t, "file.hash", []filterTestCase{
+		{input: file, args: []string{"md5"}, want: "900150983cd24fb0d6963f7d28e17f72"},
+		{input: file, args: []string{"SHA1"}, want: "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{input: file, args: []string{"sha256"}, want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{input: filepath.Join(dir, "empty"), args: []string{"md5"}, want: "d41d8cd98f00b204e9800998ecf8427e"},
+		{input: file, args: []string{"crc32"}, fail: true},
+		{input: file, fail: true},
+		{input: filepath.Join(dir, "missing"), args: []string{"md5"}, fail: true},
+	})
+
+	hash := func(root string) string {
+		t.Helper()
+		h, err := hashDir("sha256", root)
+		if err != nil {
+			t.Fatalf("hash %s failed: %v", root, err)
+		}
+		return h
+	}
+	files := map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "bb",
+		"sub/c/d":   "",
+	}
+	// same tree created in different order and time
+	tree1, tree2 := filepath.Join(dir, "tree1"), filepath.Join(dir, "tree2")
+	writeTestTree(t, tree1, files)
+	for _, name := range []string{"sub/c/d", "sub/b.txt", "a.txt"} {
+		writeTestTree(t, tree2, map[string]string{name: files[name]})
+	}
+	later := time.Now().Add(time.Hour)
+	err := os.Chtimes(filepath.Join(tree2, "a.txt"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := hash(tree1)
+	if hash(tree1) != base || hash(tree2) != base {
+		t.Fatalf("hash of the same tree should be stable")
+	}
+
+	changes := []struct {
+		desc   string
+		change func(root string) error
+	}{
+		{"content changed", func(root string) error {
+			return ioutil.WriteFile(filepath.Join(root, "sub/b.txt"), []byte("bc"), 0644)
+		}},
+		{"file renamed", func(root string) error {
+			return os.Rename(filepath.Join(root, "sub/b.txt"), filepath.Join(root, "sub/b2.txt"))
+		}},
+		{"file moved", func(root string) error {
+			return os.Rename(filepath.Join(root, "sub/b.txt"), filepath.Join(root, "sub/c/b.txt"))
+		}},
+		{"content moved to another file", func(root string) error {
+			err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("ab"), 0644)
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(root, "sub/b.txt"), []byte("b"), 0644)
+			}
+			return err
+		}},
+		{"empty file added", func(root string) error {
+			return ioutil.WriteFile(filepath.Join(root, "new"), nil, 0644)
+		}},
+		{"empty directory added", func(root string) error {
+			return os.Mkdir(filepath.Join(root, "new"), 0755)
+		}},
+		{"file removed", func(root string) error {
+			return os.Remove(filepath.Join(root, "sub/c/d"))
+		}},
+	}
+	for i, c := range changes {
+		root := filepath.Join(dir, "changed"+strconv.Itoa(i))
+		writeTestTree(t, root, files)
+		err := c.change(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash(root) == base {
+			t.Errorf("%s: hash isn't changed", c.desc)
+		}
+	}
+
+	runFilterTests(t, "dir.hash", []filterTestCase{
+		{input: tree1, args: []string{"sha256"}, want: base},
+		{input: tree1, args: []string{"sha512"}, fail: true},
+		{input: filepath.Join(dir, "missing"), args: []string{"md5"}, fail: true},
+	})
+}
+
+func TestStringFormatFilter(t *testing.T) {
+	runFilterTests(t, "string.format", []filterTestCase{
+		{input: "42", args: []string{"%d"}, want: "42"},
+		{input: "42", args: []string{"%05d|%x|%X|%o|%b", "255", "255", "8", "5"}, want: "00042|ff|FF|10|101"},
+		{input: "0x1f", args: []string{"%d"}, want: "31"},
+		{input: "65", args: []string{"%c"}, want: "A"},
+		{input: "3.14159", args: []string{"%.2f"}, want: "3.14"},
+		{input: "1", args: []string{"%8.3f|%-6g|%e", "2.5", "1000"}, want: "   1.000|2.5   |1.000000e+03"},
+		{input: "abc", args: []string{"[%-5s][%5s][%q]", "de", "f"}, want: `[abc  ][   de]["f"]`},
+		{input: "x", args: []string{"%v %s", "y"}, want: "x y"},
+		{input: "50", args: []string{"%d%%"}, want: "50%"},
+		{input: "x", args: []string{"100%% %s"}, want: "100% x"},
+		{input: "x", args: []string{"%+d", "1"}, fail: true},
+		// missing operands
+		{input: "1", args: []string{"%d %d"}, fail: true},
+		// too many operands
+		{input: "1", args: []string{"%d", "2"}, fail: true},
+		{input: "1", args: []string{"no verbs"}, fail: true},
+		// operands are converted by verbs
+		{input: "abc", args: []string{"%d"}, fail: true},
+		{input: "1.5", args: []string{"%d"}, fail: true},
+		{input: "abc", args: []string{"%f"}, fail: true},
+		{input: "1", args: []string{"%s %x", "0xzz"}, fail: true},
+		// unsupported width, precision and argument index
+		{input: "5", args: []string{"%*d", "1"}, fail: true},
+		{input: "1.5", args: []string{"%.*f", "1"}, fail: true},
+		{input: "1", args: []string{"%[1]d"}, fail: true},
+		{input: "1", args: nil, fail: true},
+	})
+}
+
+func TestStringPadFilter(t *testing.T) {
+	runFilterTests(t, "string.pad", []filterTestCase{
+		{input: "7", args: []string{"left", "3", "0"}, want: "007"},
+		{input: "ab", args: []string{"right", "4"}, want: "ab  "},
+		{input: "ab", args: []string{"left", "4", "."}, want: "..ab"},
+		{input: "中文", args: []string{"right", "4", "字"}, want: "中文字字"},
+		{input: "abcd", args: []string{"left", "2"}, want: "abcd"},
+		{input: "abcd", args: []string{"left", "-1"}, want: "abcd"},
+		{input: "", args: []string{"left", "2", "-"}, want: "--"},
+		{input: "ab", args: []string{"center", "4"}, fail: true},
+		{input: "ab", args: []string{"left", "x"}, fail: true},
+		{input: "ab", args: []string{"left", "4", "ab"}, fail: true},
+		{input: "ab", args: []string{"left", "4", ""}, fail: true},
+		{input: "ab", args: []string{"left"}, fail: true},
+	})
+}
+
+func TestStringMatchFilter(t *testing.T) {
+	runFilterTests(t, "string.match", []filterTestCase{
+		{input: "version: 1.2.3", args: []string{"[0-9.]+"}, want: "1.2.3"},
+		{input: "version: 1.2.3", args: []string{"([0-9]+)\\.([0-9]+)", "2"}, want: "2"},
+		{input: "version: 1.2.3", args: []string{"([0-9]+)\\.([0-9]+)", "0"}, want: "1.2"},
+		// leftmost longest matching of POSIX regexp
+		{input: "abcd", args: []string{"a|ab|abc"}, want: "abc"},
+		{input: "version: x", args: []string{"([0-9]+)", "1"}, want: ""},
+		{input: "abc", args: []string{"(a)(x)?", "2"}, want: ""},
+		{input: "abc", args: []string{"(a)", "2"}, fail: true},
+		{input: "abc", args: []string{"(a)", "-1"}, fail: true},
+		{input: "abc", args: []string{"(a"}, fail: true},
+		{input: "abc", args: nil, fail: true},
+	})
+}
+
+func TestArrayMapAndUniqueFilters(t *testing.T) {
+	runFilterTests(t, "array.map", []filterTestCase{
+		{input: "a b c", args: []string{"string.transform upper"}, want: "A B C"},
+		{input: "a.go,b.go", args: []string{"file.noext | string.transform upper", ","}, want: "A,B"},
+		{input: "1 2", args: []string{`string.format "<%s>"`}, want: "<1> <2>"},
+		{input: "", args: []string{"string.transform upper"}, want: ""},
+		{input: "a b", args: []string{"no.such.filter"}, fail: true},
+		{input: "a b", args: nil, fail: true},
+	})
+	runFilterTests(t, "array.unique", []filterTestCase{
+		{input: "b a b c a", want: "b a c"},
+		{input: "x,y,x", args: []string{","}, want: "x,y"},
+		{input: "a", want: "a"},
+		{input: "a b", args: []string{",", "x"}, fail: true},
+	})
+
+	e := newExpandEnvs()
+	e.setValue("L", listValue([]string{"b x", "a", "b x", "A"}))
+	cases := []struct {
+		s    string
+		want []string
+	}{
+		{`${L | array.unique}`, []string{"b x", "a", "A"}},
+		{`${L | array.map "string.transform upper" | array.unique}`, []string{"B X", "A"}},
+		{`${L | array.map "string.split ' ' \| array.join -"}`, []string{"b-x", "a", "b-x", "A"}},
+	}
+	for _, c := range cases {
+		v, err := e.expandValue(c.s)
+		if err != nil {
+			t.Errorf("expand %s failed: %v", c.s, err)
+			continue
+		}
+		if !v.isList || strings.Join(v.list, "|") != strings.Join(c.want, "|") {
+			t.Errorf("expand %s: want list %q, got %+v", c.s, c.want, v)
+		}
+	}
+}
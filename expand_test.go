@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// baselineExpandString is the rune scanning expander used before expansions were compiled,
+// it's kept as the reference behavior of compiled expansions.
+func baselineExpandString(e *ExpandEnvs, s string) (string, error) {
+	const (
+		statePlain = iota
+		stateVar
+		stateName
+		stateBlockName
+	)
+	var (
+		state = statePlain
+
+		buf              []rune
+		nameBuf          []rune
+		nameBlockFilters []int
+		nameBlockDepth   int
+
+		err error
+	)
+	resolveVar := func() []rune {
+		var name string
+		var filters []string
+		if len(nameBlockFilters) > 0 {
+			for i := range nameBlockFilters {
+				if i == 0 {
+					name = string(nameBuf[:nameBlockFilters[i]])
+				} else {
+					filters = append(filters, string(nameBuf[nameBlockFilters[i-1]+1:nameBlockFilters[i]]))
+				}
+			}
+			filters = append(filters, string(nameBuf[nameBlockFilters[len(nameBlockFilters)-1]+1:]))
+		} else {
+			name = string(nameBuf)
+		}
+		name = strings.TrimSpace(name)
+		for i := range filters {
+			filters[i] = strings.TrimSpace(filters[i])
+		}
+		var v string
+		v, err = baselineLookupAndFilter(e, name, filters)
+		return []rune(v)
+	}
+	rs := []rune(s)
+	l := len(rs)
+	for i := 0; i < l; i++ {
+		switch state {
+		case statePlain:
+			switch rs[i] {
+			case '$':
+				state = stateVar
+				nameBuf = nameBuf[:0]
+				nameBlockFilters = nameBlockFilters[:0]
+				nameBlockDepth = 0
+			case '\\':
+				if i < l-1 {
+					i++
+					buf = append(buf, rs[i])
+				}
+			default:
+				buf = append(buf, rs[i])
+			}
+		case stateVar:
+			switch {
+			case rs[i] == '{':
+				state = stateBlockName
+			case isAlphaNum(rs[i]):
+				state = stateName
+				nameBuf = append(nameBuf, rs[i])
+			default:
+				state = statePlain
+				i--
+			}
+		case stateName:
+			switch {
+			case isAlphaNum(rs[i]):
+				nameBuf = append(nameBuf, rs[i])
+			default:
+				buf = append(buf, resolveVar()...)
+				if err != nil {
+					return "", err
+				}
+				state = statePlain
+				i--
+			}
+		case stateBlockName:
+			switch rs[i] {
+			case '\\':
+				nameBuf = append(nameBuf, rs[i])
+				if i < l-1 {
+					i++
+					nameBuf = append(nameBuf, rs[i])
+				}
+			case '{':
+				nameBuf = append(nameBuf, rs[i])
+				nameBlockDepth++
+			case '|':
+				nameBuf = append(nameBuf, rs[i])
+				if nameBlockDepth == 0 {
+					nameBlockFilters = append(nameBlockFilters, len(nameBuf)-1)
+				}
+			case '}':
+				if nameBlockDepth > 0 {
+					nameBuf = append(nameBuf, rs[i])
+					nameBlockDepth--
+				} else {
+					buf = append(buf, resolveVar()...)
+					if err != nil {
+						return "", err
+					}
+					state = statePlain
+				}
+			default:
+				nameBuf = append(nameBuf, rs[i])
+			}
+		}
+	}
+	switch state {
+	case statePlain:
+	case stateVar:
+	case stateName:
+		if len(nameBuf) > 0 {
+			buf = append(buf, resolveVar()...)
+			if err != nil {
+				return "", err
+			}
+		}
+	case stateBlockName:
+		if len(nameBuf) > 0 {
+			buf = append(buf, nameBuf...)
+		}
+	}
+	return string(buf), nil
+}
+
+func baselineLookupAndFilter(e *ExpandEnvs, name string, filters []string) (string, error) {
+	var val string
+	if us := stringUnquote(name); us != name {
+		if strings.Contains(us, "$") {
+			var err error
+			val, err = baselineExpandString(e, us)
+			if err != nil {
+				return "", fmt.Errorf("expand failed: `%s`, %w", us, err)
+			}
+		} else {
+			val = us
+		}
+	} else {
+		val, _ = e.get(name)
+	}
+
+	for _, filter := range filters {
+		originFilter := filter
+		filter, err := baselineExpandString(e, stringUnquote(filter))
+		if err != nil {
+			return "", fmt.Errorf("invalid expand filter: %s, %w", originFilter, err)
+		}
+		args, err := parseFilterArgs(originFilter, filter)
+		if err != nil {
+			return "", err
+		}
+		res, err := e.callFilter(originFilter, stringValue(val), args)
+		if err != nil {
+			return "", err
+		}
+		val = res.String()
+	}
+	return val, nil
+}
+
+func newTestExpandEnvs() *ExpandEnvs {
+	e := newExpandEnvs()
+	e.set("A", "abc")
+	e.set("B", "")
+	e.set("P", `C:\path`)
+	e.set("X", "b")
+	e.set("NAME", "file.go")
+	return e
+}
+
+func TestExpandStringBaseline(t *testing.T) {
+	cases := []string{
+		``,
+		`abc`,
+		`a\$b`,
+		`a\\b`,
+		`$`,
+		`a$`,
+		`$A`,
+		`$A.txt`,
+		`${A}`,
+		`x${A}y$A`,
+		`${ A }`,
+		`${UNDEFINED}`,
+		`${A`,
+		`${"a\d+"}`,
+		`${"C:\path"}`,
+		`${'C:\path'}`,
+		`${"a\d+" | string.default x}`,
+		`${"$A\d+"}`,
+		`${"${A}-x"}`,
+		`${"" | string.default def}`,
+		`${B | string.default "d e"}`,
+		`${P}`,
+		`${A | string.transform upper}`,
+		`${A | string.transform replace b c}`,
+		`${A | string.transform replace $X z}`,
+		`${A | string.transform replace ${X} "z z"}`,
+		`${A | string.transform regexpReplace "b.*" \\d}`,
+		`${A | string.transform upper | string.transform lower}`,
+		`${A | string.match "a(b)c" 1}`,
+		`${NAME | file.ext}`,
+		`${A | == abc}`,
+		`${A | {}}`,
+		`${A | unknown}`,
+		`${"x" | string.transform replace}`,
+	}
+	for _, c := range cases {
+		e := newTestExpandEnvs()
+		want, wantErr := baselineExpandString(e, c)
+		got, gotErr := e.expandString(c)
+		if (wantErr != nil) != (gotErr != nil) {
+			t.Errorf("expand %q: error mismatch, baseline: %v, compiled: %v", c, wantErr, gotErr)
+			continue
+		}
+		if got != want {
+			t.Errorf("expand %q: baseline: %q, compiled: %q", c, want, got)
+		}
+	}
+}
+
+func TestExpandQuotedLiteral(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+	}{
+		{`${"a\d+"}`, `a\d+`},
+		{`${"C:\path"}`, `C:\path`},
+		{`${"$A\d"}`, `abcd`},
+		{`${"a\d+" | string.transform upper}`, `A\D+`},
+	}
+	for _, c := range cases {
+		got, err := newTestExpandEnvs().expandString(c.s)
+		if err != nil {
+			t.Errorf("expand %q failed: %v", c.s, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("expand %q: want %q, got %q", c.s, c.want, got)
+		}
+	}
+}
+
+func benchmarkExpand(b *testing.B, inputs []string) {
+	e := newTestExpandEnvs()
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, s := range inputs {
+				_, err := e.expandString(s)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("baseline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, s := range inputs {
+				_, err := baselineExpandString(e, s)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// BenchmarkExpandLoop expands the same loop body strings for each iteration.
+func BenchmarkExpandLoop(b *testing.B) {
+	benchmarkExpand(b, []string{
+		`build/${NAME | file.noext}.o`,
+		`${NAME | file.basename | string.transform upper}`,
+		`cc -c $NAME -o ${NAME | file.noext}.o -DNAME=${A | string.transform replace $X z}`,
+		`echo "$A $NAME"`,
+	})
+}
+
+// BenchmarkExpandReplacePairs expands long replace filter chains, such as replace action pairs.
+func BenchmarkExpandReplacePairs(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("${A")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&sb, " | string.transform replace old%d new%d", i, i)
+	}
+	sb.WriteString("}")
+	benchmarkExpand(b, []string{sb.String()})
+}
+
+// BenchmarkExpandPlain expands long strings without variables.
+func BenchmarkExpandPlain(b *testing.B) {
+	benchmarkExpand(b, []string{strings.Repeat("plain text without variables, ", 20)})
+}
+
+func newTestListEnvs() *ExpandEnvs {
+	e := newTestExpandEnvs()
+	e.setValue("L", listValue([]string{"a b", "c'd"}))
+	e.setValue("M", listValue([]string{`C:\new`, "$A"}))
+	e.set("S", "x y")
+	return e
+}
+
+func TestExpandListPassthrough(t *testing.T) {
+	cases := []struct {
+		s      string
+		isList bool
+		want   []string
+	}{
+		{`$L`, true, []string{"a b", "c'd"}},
+		{`${L}`, true, []string{"a b", "c'd"}},
+		{`${L | array.reverse}`, true, []string{"c'd", "a b"}},
+		{`${L | array.reverse | array.sort}`, true, []string{"a b", "c'd"}},
+		{`${L | string.default x}`, true, []string{"a b", "c'd"}},
+		{`${L | array.map "string.transform upper"}`, true, []string{"A B", "C'D"}},
+		{`${L | array.map "string.transform upper" | array.reverse}`, true, []string{"C'D", "A B"}},
+		{`${L | array.slice 1}`, true, []string{"c'd"}},
+		{`${L | string.transform upper}`, false, []string{"A B C'D"}},
+		{`${L | array.join ,}`, false, []string{"a b,c'd"}},
+		{`x$L`, false, []string{"xa b c'd"}},
+		{`$S`, false, []string{"x y"}},
+	}
+	for _, c := range cases {
+		v, err := newTestListEnvs().expandValue(c.s)
+		if err != nil {
+			t.Errorf("expand %q failed: %v", c.s, err)
+			continue
+		}
+		if v.isList != c.isList {
+			t.Errorf("expand %q: want list %v, got %v", c.s, c.isList, v.isList)
+			continue
+		}
+		got := []string{v.str}
+		if v.isList {
+			got = v.list
+		}
+		if strings.Join(got, "\x00") != strings.Join(c.want, "\x00") {
+			t.Errorf("expand %q: want %q, got %q", c.s, c.want, got)
+		}
+	}
+}
+
+func TestExpandCommandArgv(t *testing.T) {
+	cases := []struct {
+		s    string
+		want [][]string
+	}{
+		{`echo $L`, [][]string{{"echo", "a b", "c'd"}}},
+		{`echo ${L | array.reverse} end`, [][]string{{"echo", "c'd", "a b", "end"}}},
+		{`echo x${L}y '$L'`, [][]string{{"echo", "xa b c'dy", "a b c'd"}}},
+		{`echo "n: $L" end`, [][]string{{"echo", "n: a b c'd", "end"}}},
+		{`echo '$L'"$L"`, [][]string{{"echo", "a b c'da b c'd"}}},
+		{`echo $L|cat $L`, [][]string{{"echo", "a b", "c'd"}, {"cat", "a b", "c'd"}}},
+		{`echo $M "$M"`, [][]string{{"echo", `C:\new`, "$A", `C:\new $A`}}},
+		{`echo $S`, [][]string{{"echo", "x", "y"}}},
+		{`echo "$S"`, [][]string{{"echo", "x y"}}},
+	}
+	for _, c := range cases {
+		e := newTestListEnvs()
+		cmd, err := e.expandCommand(c.s)
+		if err != nil {
+			t.Errorf("expand command %q failed: %v", c.s, err)
+			continue
+		}
+		got, err := parseCommand(e, cmd, "")
+		if err != nil {
+			t.Errorf("parse command %q expanded from %q failed: %v", cmd, c.s, err)
+			continue
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", c.want) {
+			t.Errorf("expand command %q: want %q, got %q", c.s, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// +build darwin freebsd
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+func fileAccessTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Atimespec.Unix())
+}
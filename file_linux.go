@@ -0,0 +1,10 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+func fileAccessTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Atim.Unix())
+}
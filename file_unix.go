@@ -0,0 +1,49 @@
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// access(2) modes
+const (
+	accessRead    = 0x4
+	accessWrite   = 0x2
+	accessExecute = 0x1
+)
+
+// checkFileAccess checks file permission for effective user with access(2) semantics.
+func checkFileAccess(path string, mode uint32) bool {
+	return syscall.Access(path, mode) == nil
+}
+
+func checkFileOwnedByUser(stat os.FileInfo) (bool, error) {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, nil
+	}
+	return int(st.Uid) == os.Geteuid(), nil
+}
+
+func checkFileOwnedByGroup(stat os.FileInfo) (bool, error) {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, nil
+	}
+	return int(st.Gid) == os.Getegid(), nil
+}
+
+func checkFileModifiedSinceRead(stat os.FileInfo) bool {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return stat.ModTime().After(fileAccessTime(st))
+}
+
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
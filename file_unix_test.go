@@ -0,0 +1,135 @@
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileAccessConditions(t *testing.T) {
+	dir := t.TempDir()
+	for name, perm := range map[string]os.FileMode{
+		"rw":   0644,
+		"ro":   0444,
+		"wo":   0200,
+		"exe":  0755,
+		"none": 0,
+	} {
+		p := filepath.Join(dir, name)
+		writeTestTree(t, dir, map[string]string{name: "#!/bin/sh\n"})
+		err := os.Chmod(p, perm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := newExpandEnvs()
+	e.set("DIR", dir)
+
+	// access(2) ignores read/write permission bits for root
+	root := os.Geteuid() == 0
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"-r $DIR/rw && -w $DIR/rw", true},
+		{"-x $DIR/rw", false},
+		{"-r $DIR/ro", true},
+		{"-w $DIR/ro", root},
+		{"-r $DIR/wo", root},
+		{"-w $DIR/wo", true},
+		{"-x $DIR/exe && -r $DIR/exe", true},
+		{"-r $DIR/none || -w $DIR/none", root},
+		{"-x $DIR/none", false},
+		{"-r $DIR && -w $DIR && -x $DIR", true},
+		{"-r $DIR/missing || -w $DIR/missing || -x $DIR/missing", false},
+
+		// files created by the test are owned by effective user and group
+		{"-O $DIR/rw && -G $DIR/rw", true},
+		{"-O $DIR && -G $DIR", true},
+		{"-O $DIR/missing || -G $DIR/missing", false},
+	}
+	for _, c := range cases {
+		got, err := evalCondition(e, c.expr)
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("eval %q: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+
+	if !root {
+		return
+	}
+	// ownership is compared with effective uid and gid
+	err := os.Chown(filepath.Join(dir, "rw"), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{"-O $DIR/rw", "-G $DIR/rw"} {
+		got, err := evalCondition(e, expr)
+		if err != nil || got {
+			t.Errorf("eval %q: want false for file owned by other user, got %v, %v", expr, got, err)
+		}
+	}
+}
+
+func TestFileModifiedSinceReadCondition(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"file": "content"})
+	p := filepath.Join(dir, "file")
+	e := newExpandEnvs()
+	e.set("FILE", p)
+
+	now := time.Now().Truncate(time.Second)
+	cases := []struct {
+		atime, mtime time.Time
+		want         bool
+	}{
+		{now.Add(-time.Hour), now, true},
+		{now, now.Add(-time.Hour), false},
+		{now, now, false},
+	}
+	for _, c := range cases {
+		err := os.Chtimes(p, c.atime, c.mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := evalCondition(e, "-N $FILE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("atime %s mtime %s: want %v, got %v", c.atime, c.mtime, c.want, got)
+		}
+	}
+	got, err := evalCondition(e, "-N $FILE.missing")
+	if err != nil || got {
+		t.Errorf("missing file: want false, got %v, %v", got, err)
+	}
+}
+
+func TestTerminalCondition(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"file": "content"})
+	fd, err := os.Open(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	ok, err := checkCondition(newExpandEnvs(), strconv.FormatUint(uint64(fd.Fd()), 10), "-t", nil)
+	if err != nil || ok {
+		t.Errorf("regular file descriptor: want false, got %v, %v", ok, err)
+	}
+	for _, value := range []string{"-1", "x"} {
+		_, err = checkCondition(newExpandEnvs(), value, "-t", nil)
+		if err == nil {
+			t.Errorf("invalid file descriptor %q should be reported", value)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	accessRead    = 0x4
+	accessWrite   = 0x2
+	accessExecute = 0x1
+)
+
+// checkFileAccess emulates access(2): files are readable if they could be opened,
+// writable if they are not read-only, and executable if they are directories or have extension in PATHEXT.
+func checkFileAccess(path string, mode uint32) bool {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if mode&accessRead != 0 && !stat.IsDir() {
+		fd, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		fd.Close()
+	}
+	if mode&accessWrite != 0 && stat.Mode().Perm()&0200 == 0 {
+		return false
+	}
+	if mode&accessExecute != 0 && !stat.IsDir() {
+		exts := os.Getenv("PATHEXT")
+		if exts == "" {
+			exts = ".com;.exe;.bat;.cmd"
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		for _, e := range strings.Split(strings.ToLower(exts), ";") {
+			if e != "" && e == ext {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func checkFileOwnedByUser(stat os.FileInfo) (bool, error) {
+	return false, fmt.Errorf("file ownership checking is not supported on windows")
+}
+
+func checkFileOwnedByGroup(stat os.FileInfo) (bool, error) {
+	return false, fmt.Errorf("file ownership checking is not supported on windows")
+}
+
+func checkFileModifiedSinceRead(stat os.FileInfo) bool {
+	attr, ok := stat.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+	return stat.ModTime().After(time.Unix(0, attr.LastAccessTime.Nanoseconds()))
+}
+
+// ERROR_NOT_SAME_DEVICE
+const errorNotSameDevice syscall.Errno = 17
+
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
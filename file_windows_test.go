@@ -0,0 +1,71 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileAccessConditions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{
+		"file.txt": "content",
+		"ro.txt":   "content",
+		"run.exe":  "",
+		"run.BAT":  "",
+		"run.ps1":  "",
+	})
+	// read-only attribute is set by removing write permission
+	ro := filepath.Join(dir, "ro.txt")
+	err := os.Chmod(ro, 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(ro, 0644) })
+	e := newExpandEnvs()
+	e.set("DIR", filepath.ToSlash(dir))
+
+	cases := []struct {
+		pathext string
+		expr    string
+		want    bool
+	}{
+		{"", "-r $DIR/file.txt && -w $DIR/file.txt", true},
+		{"", "-r $DIR/ro.txt", true},
+		{"", "-w $DIR/ro.txt", false},
+		{"", "-r $DIR && -w $DIR && -x $DIR", true},
+		{"", "-r $DIR/missing || -w $DIR/missing || -x $DIR/missing", false},
+
+		// executable files are recognized by extension in PATHEXT, or the default list if it's empty
+		{"", "-x $DIR/file.txt", false},
+		{"", "-x $DIR/run.exe && -x $DIR/run.BAT", true},
+		{"", "-x $DIR/run.ps1", false},
+		{".PS1;.EXE", "-x $DIR/run.ps1 && -x $DIR/run.exe", true},
+		{".PS1;.EXE", "-x $DIR/run.BAT", false},
+	}
+	for _, c := range cases {
+		t.Setenv("PATHEXT", c.pathext)
+		got, err := evalCondition(e, c.expr)
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("PATHEXT %q: eval %q: want %v, got %v", c.pathext, c.expr, c.want, got)
+		}
+	}
+
+	// ownership isn't supported, but missing files are still reported as false
+	for _, op := range []string{"-O", "-G"} {
+		_, err := evalCondition(e, op+" $DIR/file.txt")
+		if err == nil {
+			t.Errorf("%s should be reported as unsupported", op)
+		}
+		got, err := evalCondition(e, op+" $DIR/missing")
+		if err != nil || got {
+			t.Errorf("%s missing file: want false, got %v, %v", op, got, err)
+		}
+	}
+}
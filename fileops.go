@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// destPath returns dest of source: dest is directory if there are multiple sources or it's an existing directory.
+func destPath(src, dest string, multiple bool) string {
+	if multiple {
+		return filepath.Join(dest, filepath.Base(src))
+	}
+	stat, err := os.Stat(dest)
+	if err == nil && stat.IsDir() {
+		return filepath.Join(dest, filepath.Base(src))
+	}
+	return dest
+}
+
+// checkDest checks whether dest exists, it reports error if dest exists and overwrite isn't set.
+func checkDest(dest string, overwrite bool) (bool, error) {
+	_, err := os.Lstat(dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !overwrite {
+		return false, fmt.Errorf("dest path already existed: %s", dest)
+	}
+	return true, nil
+}
+
+// clearDest removes existing dest if overwrite is set, otherwise it reports error.
+func clearDest(dest string, overwrite bool) error {
+	exist, err := checkDest(dest, overwrite)
+	if err != nil || !exist {
+		return err
+	}
+	return os.RemoveAll(dest)
+}
+
+// stagingDir creates temporary directory next to path, so renaming between them doesn't cross devices.
+func stagingDir(path string) (string, error) {
+	return ioutil.TempDir(filepath.Dir(path), "."+filepath.Base(path)+".tash-")
+}
+
+// movePath renames src to dest, it falls back to copying and deleting if they are on different devices.
+// existing dest is moved aside and it's removed only after src is moved, or restored if moving failed.
+func movePath(src, dest string, overwrite bool) error {
+	srcAbs, e1 := filepath.Abs(src)
+	destAbs, e2 := filepath.Abs(dest)
+	if e1 == nil && e2 == nil && srcAbs == destAbs {
+		return nil
+	}
+	exist, err := checkDest(dest, overwrite)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return fmt.Errorf("create dest parent directory tree failed: %w", err)
+	}
+	var backupDir, backup string
+	if exist {
+		backupDir, err = stagingDir(dest)
+		if err != nil {
+			return fmt.Errorf("create backup directory failed: %w", err)
+		}
+		backup = filepath.Join(backupDir, filepath.Base(dest))
+		err = os.Rename(dest, backup)
+		if err != nil {
+			os.RemoveAll(backupDir)
+			return fmt.Errorf("move existing dest aside failed: %w", err)
+		}
+	}
+
+	var copied bool
+	err = os.Rename(src, dest)
+	if err != nil && isCrossDeviceError(err) {
+		err = copyAcrossDevices(src, dest)
+		copied = err == nil
+	}
+	if err != nil && backup != "" {
+		if e := os.Rename(backup, dest); e != nil {
+			return fmt.Errorf("%w, restore dest failed: %s, it's kept at %s", err, e, backup)
+		}
+	}
+	if backupDir != "" {
+		os.RemoveAll(backupDir)
+	}
+	if err != nil || !copied {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyAcrossDevices copies src to temporary path next to dest, then renames it to dest.
+func copyAcrossDevices(src, dest string) error {
+	dir, err := stagingDir(dest)
+	if err != nil {
+		return fmt.Errorf("create staging directory failed: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	staged := filepath.Join(dir, filepath.Base(dest))
+	_, err = copyPath(staged, src, copyOptions{preserveSymlinks: true})
+	if err != nil {
+		return fmt.Errorf("copy across devices failed: %w", err)
+	}
+	return os.Rename(staged, dest)
+}
+
+// linkPath creates link at path, target is path relative to working directory, symbolic link stores
+// absolute target path, or relative path to link directory if relative is set.
+func linkPath(target, path string, symbolic, relative, force bool) error {
+	err := clearDest(path, force)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("create link parent directory tree failed: %w", err)
+	}
+	if !symbolic {
+		return os.Link(target, path)
+	}
+	if relative {
+		targetAbs, e1 := filepath.Abs(target)
+		dirAbs, e2 := filepath.Abs(filepath.Dir(path))
+		if e1 != nil || e2 != nil {
+			return fmt.Errorf("resolve absolute path failed: %s %s", e1, e2)
+		}
+		target, err = filepath.Rel(dirAbs, targetAbs)
+	} else {
+		target, err = filepath.Abs(target)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, path)
+}
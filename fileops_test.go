@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMovePathKeepsDestOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "dest")
+	err = ioutil.WriteFile(dest, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = movePath(filepath.Join(dir, "missing"), dest, true)
+	if err == nil {
+		t.Errorf("moving missing source should fail")
+	}
+	content, err := ioutil.ReadFile(dest)
+	if err != nil || string(content) != "old" {
+		t.Errorf("dest should be kept: %q, %v", content, err)
+	}
+	names, err := ioutil.ReadDir(dir)
+	if err != nil || len(names) != 1 {
+		t.Errorf("backup directory should be removed: %v, %v", names, err)
+	}
+}
+
+func TestMovePathOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	err = ioutil.WriteFile(src, []byte("new"), 0644)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(dest, "sub"), 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = movePath(src, dest, false)
+	if err == nil {
+		t.Errorf("moving to existing dest without overwrite should fail")
+	}
+	err = movePath(src, dest, true)
+	if err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	content, err := ioutil.ReadFile(dest)
+	if err != nil || string(content) != "new" {
+		t.Errorf("dest should be replaced: %q, %v", content, err)
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("src should be removed: %v", err)
+	}
+	names, err := ioutil.ReadDir(dir)
+	if err != nil || len(names) != 1 {
+		t.Errorf("backup directory should be removed: %v, %v", names, err)
+	}
+}
@@ -7,11 +7,13 @@ require (
 	github.com/cosiner/flag v0.5.2
 	github.com/fatih/color v1.9.0
 	github.com/fsnotify/fsnotify v1.4.9
-	github.com/ghodss/yaml v1.0.0
 	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/mattn/go-isatty v0.0.12
 	github.com/mattn/go-zglob v0.0.1
 	github.com/mitchellh/go-ps v1.0.0
-	github.com/tidwall/gjson v1.6.7 // indirect
+	github.com/pelletier/go-toml v1.9.5
+	github.com/tidwall/gjson v1.14.2
+	github.com/tidwall/sjson v1.2.5
 	golang.org/x/sys v0.0.0-20200420163511-1957bb5e6d1f // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -5,7 +5,7 @@ import (
 )
 
 type Flags struct {
-	Conf     string `names:"-c, --conf" usage:"config file, default tash.yaml in current/ancestor directory"`
+	Conf     string `names:"-c, --conf" usage:"config file, default tash.yaml/yml/json/toml in current/ancestor directory"`
 	SaveConf bool   `names:"-s, --save" usage:"save current config file path to .tashfile" desc:"--conf option should also be present, but it could be omitted in later commands"`
 	List     struct {
 		Enable bool
@@ -17,6 +17,8 @@ type Flags struct {
 	// global command
 	Debug    bool     `names:"-d, --debug" usage:"show debug messages"`
 	TaskArgs []string `names:"-a, --args" usage:"add task args" desc:"each arg could be multiple semicolon separated key=value pair"`
+	All      bool     `names:"--all" usage:"discover projects in subdirectories, run/list tasks in every project defines it" desc:"directories ignored by .gitignore are skipped"`
+	Excludes []string `names:"-x, --exclude" usage:"exclude directories from project discovering, support glob"`
 	Tasks    []string `args:"true" argsAnywhere:"true"`
 }
 
@@ -24,7 +26,7 @@ func (f *Flags) Metadata() map[string]flag.Flag {
 	return map[string]flag.Flag{
 		"": {
 			Desc:    "task runner",
-			Arglist: "TASK... [OPTION]... | list [TASK]... [OPTION]...",
+			Arglist: "[PROJECT:]TASK... [OPTION]... | list [TASK]... [OPTION]...",
 		},
 	}
 }
@@ -34,13 +36,14 @@ func main() {
 	_ = flag.ParseStruct(&flags)
 
 	log := newLogger(flags.Debug)
-	configs := parseConfiguration(log, flags.Conf, flags.SaveConf)
+	configs, conf := parseConfiguration(log, flags.Conf, flags.SaveConf)
+	ws := newWorkspace(log, conf, configs, flags.Excludes)
 	switch {
 	default:
 		fallthrough
 	case flags.List.Enable:
-		listTasks(configs, log, flags.List.Tasks, flags.List.ShowArgs)
+		ws.listTasks(log, flags.List.Tasks, flags.List.ShowArgs, flags.All)
 	case len(flags.Tasks) > 0:
-		runTasks(configs, log, flags.Tasks, flags.TaskArgs)
+		runTasks(ws, log, flags.Tasks, flags.TaskArgs, flags.All)
 	}
 }
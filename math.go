@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// number is integer or float number, integer operations keep integer semantics, such as division and modulo.
+type number struct {
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+func intNumber(i int64) number {
+	return number{i: i}
+}
+
+func floatNumber(f float64) number {
+	return number{isFloat: true, f: f}
+}
+
+// parseNumber parses integer with base prefix supported by parseInt, or float number.
+func parseNumber(s string) (number, error) {
+	i, err := parseInt(s)
+	if err == nil {
+		return intNumber(i), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return number{}, fmt.Errorf("invalid number: %s", s)
+	}
+	return floatNumber(f), nil
+}
+
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+func (n number) String() string {
+	if n.isFloat {
+		return strconv.FormatFloat(n.f, 'f', -1, 64)
+	}
+	return strconv.FormatInt(n.i, 10)
+}
+
+func compareNumber(n1, n2 number) int {
+	if !n1.isFloat && !n2.isFloat {
+		switch {
+		case n1.i < n2.i:
+			return -1
+		case n1.i > n2.i:
+			return 1
+		default:
+			return 0
+		}
+	}
+	f1, f2 := n1.float(), n2.float()
+	switch {
+	case f1 < f2:
+		return -1
+	case f1 > f2:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// mathExpr evaluates arithmetic expression: numbers, variables, + - * / %, parentheses and functions.
+//
+// grammar:
+//
+//	expr   = term {('+' | '-') term}
+//	term   = unary {('*' | '/' | '%') unary}
+//	unary  = ('+' | '-') unary | primary
+//	primary = number | name | name '(' expr {',' expr} ')' | '(' expr ')'
+type mathExpr struct {
+	s      string
+	offset int
+	lookup func(name string) (string, bool)
+}
+
+func evalMathExpr(s string, lookup func(name string) (string, bool)) (number, error) {
+	e := mathExpr{s: s, lookup: lookup}
+	n, err := e.parseExpr()
+	if err != nil {
+		return n, err
+	}
+	e.skipSpace()
+	if e.offset < len(e.s) {
+		return n, e.errorf("unexpected character: %c", e.s[e.offset])
+	}
+	return n, nil
+}
+
+func (e *mathExpr) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", e.offset, fmt.Sprintf(format, args...))
+}
+
+func (e *mathExpr) skipSpace() {
+	for e.offset < len(e.s) && strings.IndexByte(" \t\r\n", e.s[e.offset]) >= 0 {
+		e.offset++
+	}
+}
+
+// peek skips spaces and returns next character, 0 if reaches end.
+func (e *mathExpr) peek() byte {
+	e.skipSpace()
+	if e.offset < len(e.s) {
+		return e.s[e.offset]
+	}
+	return 0
+}
+
+func (e *mathExpr) parseExpr() (number, error) {
+	n, err := e.parseTerm()
+	if err != nil {
+		return n, err
+	}
+	for {
+		op := e.peek()
+		if op != '+' && op != '-' {
+			return n, nil
+		}
+		e.offset++
+		n2, err := e.parseTerm()
+		if err != nil {
+			return n, err
+		}
+		n, err = e.calc(op, n, n2)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (e *mathExpr) parseTerm() (number, error) {
+	n, err := e.parseUnary()
+	if err != nil {
+		return n, err
+	}
+	for {
+		op := e.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return n, nil
+		}
+		offset := e.offset
+		e.offset++
+		n2, err := e.parseUnary()
+		if err != nil {
+			return n, err
+		}
+		n, err = e.calc(op, n, n2)
+		if err != nil {
+			e.offset = offset
+			return n, e.errorf("%s", err)
+		}
+	}
+}
+
+func (e *mathExpr) parseUnary() (number, error) {
+	switch e.peek() {
+	case '+':
+		e.offset++
+		return e.parseUnary()
+	case '-':
+		e.offset++
+		n, err := e.parseUnary()
+		if err != nil {
+			return n, err
+		}
+		if n.isFloat {
+			return floatNumber(-n.f), nil
+		}
+		return intNumber(-n.i), nil
+	default:
+		return e.parsePrimary()
+	}
+}
+
+func (e *mathExpr) parsePrimary() (number, error) {
+	c := e.peek()
+	switch {
+	case c == 0:
+		return number{}, e.errorf("unexpected end of expression")
+	case c == '(':
+		e.offset++
+		n, err := e.parseExpr()
+		if err != nil {
+			return n, err
+		}
+		if e.peek() != ')' {
+			return n, e.errorf("missing ')'")
+		}
+		e.offset++
+		return n, nil
+	case '0' <= c && c <= '9' || c == '.':
+		begin := e.offset
+		for e.offset < len(e.s) {
+			c := e.s[e.offset]
+			if (c == '+' || c == '-') && e.offset > begin && strings.IndexByte("eE", e.s[e.offset-1]) >= 0 && !strings.HasPrefix(e.s[begin:], "0x") {
+				e.offset++
+				continue
+			}
+			if !isAlphaNum(rune(c)) && c != '.' {
+				break
+			}
+			e.offset++
+		}
+		n, err := parseNumber(e.s[begin:e.offset])
+		if err != nil {
+			e.offset = begin
+			return n, e.errorf("%s", err)
+		}
+		return n, nil
+	case isAlphaNum(rune(c)):
+		begin := e.offset
+		for e.offset < len(e.s) && isAlphaNum(rune(e.s[e.offset])) {
+			e.offset++
+		}
+		name := e.s[begin:e.offset]
+		if e.peek() == '(' {
+			e.offset++
+			return e.parseCall(begin, name)
+		}
+		val, has := e.lookup(name)
+		if !has {
+			e.offset = begin
+			return number{}, e.errorf("variable not found: %s", name)
+		}
+		n, err := parseNumber(strings.TrimSpace(val))
+		if err != nil {
+			e.offset = begin
+			return n, e.errorf("variable %s: %s", name, err)
+		}
+		return n, nil
+	default:
+		return number{}, e.errorf("unexpected character: %c", c)
+	}
+}
+
+func (e *mathExpr) parseCall(offset int, name string) (number, error) {
+	var args []number
+	if e.peek() == ')' {
+		e.offset++
+	} else {
+		for {
+			n, err := e.parseExpr()
+			if err != nil {
+				return n, err
+			}
+			args = append(args, n)
+			c := e.peek()
+			e.offset++
+			if c == ')' {
+				break
+			}
+			if c != ',' {
+				e.offset--
+				return n, e.errorf("missing ')'")
+			}
+		}
+	}
+
+	n, err := callMathFunc(name, args)
+	if err != nil {
+		e.offset = offset
+		return n, e.errorf("%s", err)
+	}
+	return n, nil
+}
+
+func callMathFunc(name string, args []number) (number, error) {
+	switch name {
+	case "min", "max":
+		if len(args) == 0 {
+			return number{}, fmt.Errorf("%s requires at least one argument", name)
+		}
+		n := args[0]
+		for _, a := range args[1:] {
+			c := compareNumber(a, n)
+			if name == "min" && c < 0 || name == "max" && c > 0 {
+				n = a
+			}
+		}
+		return n, nil
+	case "round", "ceil", "floor", "abs":
+		if len(args) != 1 {
+			return number{}, fmt.Errorf("%s requires one argument", name)
+		}
+		n := args[0]
+		if !n.isFloat {
+			if name == "abs" && n.i < 0 {
+				n.i = -n.i
+			}
+			return n, nil
+		}
+		var f float64
+		switch name {
+		case "round":
+			f = math.Round(n.f)
+		case "ceil":
+			f = math.Ceil(n.f)
+		case "floor":
+			f = math.Floor(n.f)
+		default:
+			return floatNumber(math.Abs(n.f)), nil
+		}
+		// math.MaxInt64 is rounded to 2^63 as float, NaN is also rejected
+		if !(f >= math.MinInt64 && f < math.MaxInt64) {
+			return number{}, fmt.Errorf("%s result is out of integer range: %s", name, n)
+		}
+		return intNumber(int64(f)), nil
+	default:
+		return number{}, fmt.Errorf("unsupported function: %s", name)
+	}
+}
+
+func (e *mathExpr) calc(op byte, n1, n2 number) (number, error) {
+	if !n1.isFloat && !n2.isFloat {
+		v1, v2 := n1.i, n2.i
+		switch op {
+		case '+':
+			return intNumber(v1 + v2), nil
+		case '-':
+			return intNumber(v1 - v2), nil
+		case '*':
+			return intNumber(v1 * v2), nil
+		case '/', '%':
+			if v2 == 0 {
+				return number{}, fmt.Errorf("division by zero")
+			}
+			if op == '/' {
+				return intNumber(v1 / v2), nil
+			}
+			return intNumber(v1 % v2), nil
+		}
+	}
+	v1, v2 := n1.float(), n2.float()
+	switch op {
+	case '+':
+		return floatNumber(v1 + v2), nil
+	case '-':
+		return floatNumber(v1 - v2), nil
+	case '*':
+		return floatNumber(v1 * v2), nil
+	case '/', '%':
+		if v2 == 0 {
+			return number{}, fmt.Errorf("division by zero")
+		}
+		if op == '/' {
+			return floatNumber(v1 / v2), nil
+		}
+		return floatNumber(math.Mod(v1, v2)), nil
+	}
+	return number{}, fmt.Errorf("unsupported operator: %c", op)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEvalMathExpr(t *testing.T) {
+	vars := map[string]string{
+		"A": "3",
+		"F": "1.5",
+		"S": " 4 ",
+		"H": "0x10",
+		"X": "abc",
+	}
+	lookup := func(name string) (string, bool) {
+		v, has := vars[name]
+		return v, has
+	}
+	cases := []struct {
+		expr string
+		want string
+		err  string
+	}{
+		// precedence and associativity
+		{expr: "1 + 2 * 3", want: "7"},
+		{expr: "(1 + 2) * 3", want: "9"},
+		{expr: "10 - 4 - 3", want: "3"},
+		{expr: "2 * 3 % 4", want: "2"},
+		{expr: "2 + 3 % 4 * 2", want: "8"},
+		{expr: "-2 * -3", want: "6"},
+		{expr: "--2", want: "2"},
+		{expr: "-(1 + 2)", want: "-3"},
+		{expr: " ( ( 1 ) ) ", want: "1"},
+
+		// integer and float division
+		{expr: "7 / 2", want: "3"},
+		{expr: "-7 / 2", want: "-3"},
+		{expr: "7 % 3", want: "1"},
+		{expr: "-7 % 3", want: "-1"},
+		{expr: "7.0 / 2", want: "3.5"},
+		{expr: "7 / 2.0", want: "3.5"},
+		{expr: "7.5 % 2", want: "1.5"},
+		{expr: "1 / 0", err: "at offset 2: division by zero"},
+		{expr: "1.0 / 0", err: "at offset 4: division by zero"},
+		{expr: "5 % (1 - 1)", err: "at offset 2: division by zero"},
+
+		// literals
+		{expr: "0x10 + 1", want: "17"},
+		{expr: "0b101", want: "5"},
+		{expr: "0o17", want: "15"},
+		{expr: "0x1e+1", want: "31"},
+		{expr: "1e3", want: "1000"},
+		{expr: "2E+2 / 8", want: "25"},
+		{expr: "1.5e-1 * 2", want: "0.3"},
+		{expr: ".5 + .5", want: "1"},
+		{expr: "1.2.3", err: "at offset 0: invalid number: 1.2.3"},
+		{expr: "0x", err: "at offset 0: invalid number: 0x"},
+
+		// variables
+		{expr: "A * F", want: "4.5"},
+		{expr: "S + A", want: "7"},
+		{expr: "H / 4", want: "4"},
+		{expr: "X", err: "at offset 0: variable X: invalid number: abc"},
+		{expr: "A + missing", err: "at offset 4: variable not found: missing"},
+
+		// functions
+		{expr: "min(3, 1, 2)", want: "1"},
+		{expr: "max(1, 2.5, A)", want: "3"},
+		{expr: "max(A)", want: "3"},
+		{expr: "round(2.5)", want: "3"},
+		{expr: "round(-2.5)", want: "-3"},
+		{expr: "ceil(1.2)", want: "2"},
+		{expr: "floor(-1.2)", want: "-2"},
+		{expr: "round(7)", want: "7"},
+		{expr: "abs(-3)", want: "3"},
+		{expr: "abs(-1.5)", want: "1.5"},
+		{expr: "2 * round(F)", want: "4"},
+		{expr: "round(-9223372036854775808.0)", want: "-9223372036854775808"},
+		{expr: "min()", err: "at offset 0: min requires at least one argument"},
+		{expr: "1 + round(1, 2)", err: "at offset 4: round requires one argument"},
+		{expr: "sqrt(4)", err: "at offset 0: unsupported function: sqrt"},
+		{expr: "1 + round(1e19)", err: "at offset 4: round result is out of integer range: 10000000000000000000"},
+		{expr: "floor(-1e19)", err: "at offset 0: floor result is out of integer range: -10000000000000000000"},
+		{expr: "ceil(9223372036854775807.0)", err: "at offset 0: ceil result is out of integer range: 9223372036854776000"},
+
+		// syntax errors
+		{expr: "", err: "at offset 0: unexpected end of expression"},
+		{expr: "1 +", err: "at offset 3: unexpected end of expression"},
+		{expr: "(1 + 2", err: "at offset 6: missing ')'"},
+		{expr: "1 2", err: "at offset 2: unexpected character: 2"},
+		{expr: "1 $ 2", err: "at offset 2: unexpected character: $"},
+		{expr: "max(1 2)", err: "at offset 6: missing ')'"},
+		{expr: "max(1,", err: "at offset 6: unexpected end of expression"},
+		{expr: "* 2", err: "at offset 0: unexpected character: *"},
+	}
+	for _, c := range cases {
+		n, err := evalMathExpr(c.expr, lookup)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("eval %q: want error %q, got %s, %v", c.expr, c.err, n, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if n.String() != c.want {
+			t.Errorf("eval %q: want %s, got %s", c.expr, c.want, n)
+		}
+	}
+}
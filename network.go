@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// network checking is a single quick attempt, callers should retry if they want to wait for readiness.
+const (
+	netDialTimeout    = time.Second
+	httpStatusTimeout = 3 * time.Second
+)
+
+// checkPortOpen checks whether tcp address HOST:PORT accepts connection.
+func checkPortOpen(addr string) (bool, error) {
+	_, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, fmt.Errorf("invalid address, should be HOST:PORT: %s", addr)
+	}
+	conn, err := net.DialTimeout("tcp", addr, netDialTimeout)
+	if err != nil {
+		return false, nil
+	}
+	conn.Close()
+	return true, nil
+}
+
+// checkPortFree checks whether tcp port could be listened, addr is PORT or HOST:PORT, PORT means all interfaces.
+func checkPortFree(addr string) (bool, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, fmt.Errorf("invalid address, should be PORT or HOST:PORT: %s", addr)
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return false, fmt.Errorf("invalid port: %s", port)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false, nil
+	}
+	l.Close()
+	return true, nil
+}
+
+// checkHttpStatus sends GET request without following redirects and compares response status code,
+// code could be exact such as 200 or class such as 2xx. unreachable url is treated as mismatched.
+func checkHttpStatus(url, code string) (bool, error) {
+	code = strings.ToLower(code)
+	if !isHttpStatusPattern(code) {
+		return false, fmt.Errorf("invalid http status code, should be such as 200 or 2xx: %s", code)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("invalid url: %s, %w", url, err)
+	}
+	client := http.Client{
+		Timeout: httpStatusTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, nil
+	}
+	resp.Body.Close()
+
+	status := strconv.Itoa(resp.StatusCode)
+	if strings.HasSuffix(code, "xx") {
+		return status[:1] == code[:1], nil
+	}
+	return status == code, nil
+}
+
+// isHttpStatusPattern checks status code pattern: three digits or class such as 2xx, the first digit is 1-5.
+func isHttpStatusPattern(code string) bool {
+	if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+		return false
+	}
+	if code[1:] == "xx" {
+		return true
+	}
+	return code[1] >= '0' && code[1] <= '9' && code[2] >= '0' && code[2] <= '9'
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// unusedAddr returns local address which isn't listened.
+func unusedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestCheckPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	closed := unusedAddr(t)
+
+	open, err := checkPortOpen(addr)
+	if err != nil || !open {
+		t.Errorf("listened port should be open: %v", err)
+	}
+	open, err = checkPortOpen(closed)
+	if err != nil || open {
+		t.Errorf("unused port shouldn't be open: %v", err)
+	}
+	_, err = checkPortOpen(port)
+	if err == nil {
+		t.Errorf("address without host should be invalid")
+	}
+
+	free, err := checkPortFree(addr)
+	if err != nil || free {
+		t.Errorf("listened address shouldn't be free: %v", err)
+	}
+	free, err = checkPortFree(port)
+	if err != nil || free {
+		t.Errorf("listened port shouldn't be free: %v", err)
+	}
+	free, err = checkPortFree(closed)
+	if err != nil || !free {
+		t.Errorf("unused address should be free: %v", err)
+	}
+	for _, invalid := range []string{"abc", "65536", "-1", "a:b:c"} {
+		_, err = checkPortFree(invalid)
+		if err == nil {
+			t.Errorf("port %s should be invalid", invalid)
+		}
+	}
+}
+
+func TestCheckHttpStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		path  string
+		code  string
+		match bool
+	}{
+		{"/", "200", true},
+		{"/", "2xx", true},
+		{"/", "2XX", true},
+		{"/", "201", false},
+		{"/", "3xx", false},
+		{"/redirect", "302", true},
+		{"/redirect", "3xx", true},
+		{"/redirect", "200", false},
+		{"/missing", "404", true},
+		{"/missing", "4xx", true},
+		{"/missing", "2xx", false},
+	}
+	for _, c := range cases {
+		match, err := checkHttpStatus(srv.URL+c.path, c.code)
+		if err != nil {
+			t.Errorf("check %s %s failed: %v", c.path, c.code, err)
+			continue
+		}
+		if match != c.match {
+			t.Errorf("check %s %s: want %v, got %v", c.path, c.code, c.match, match)
+		}
+	}
+
+	for _, code := range []string{"axx", "9xx", "0xx", "6xx", "2x", "2xxx", "20", "2000", "20a", "x00", ""} {
+		_, err := checkHttpStatus(srv.URL, code)
+		if err == nil {
+			t.Errorf("status code %q should be invalid", code)
+		}
+	}
+
+	match, err := checkHttpStatus("http://"+unusedAddr(t), "2xx")
+	if err != nil || match {
+		t.Errorf("unreachable url should be mismatched: %v", err)
+	}
+	_, err = checkHttpStatus("://invalid", "200")
+	if err == nil {
+		t.Errorf("invalid url should be reported")
+	}
+}
+
+func TestHttpStatusOperator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	e := newExpandEnvs()
+	e.set("URL", srv.URL)
+	for code, want := range map[string]bool{"204": true, "2xx": true, "200": false} {
+		got, err := e.expandString("${URL | http.status " + code + "}")
+		if err != nil {
+			t.Errorf("expand http.status %s failed: %v", code, err)
+			continue
+		}
+		if got != strconv.FormatBool(want) {
+			t.Errorf("http.status %s: want %v, got %s", code, want, got)
+		}
+	}
+}
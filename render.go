@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/uiez/tash/syntax"
+)
+
+// renderTemplate executes template file with envs as data and writes to dest file.
+func renderTemplate(envs *ExpandEnvs, action syntax.ActionRender) error {
+	if action.Dest == "" {
+		return fmt.Errorf("empty dest path")
+	}
+	content, err := ioutil.ReadFile(action.Template)
+	if err != nil {
+		return fmt.Errorf("read template failed: %w", err)
+	}
+	t := template.New(filepath.Base(action.Template)).Option("missingkey=error").Funcs(templateFuncs(envs))
+	switch len(action.Delims) {
+	case 0:
+	case 2:
+		t = t.Delims(action.Delims[0], action.Delims[1])
+	default:
+		return fmt.Errorf("delims should be left and right delimiter: %v", action.Delims)
+	}
+	t, err = t.Parse(string(content))
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]interface{})
+	for k, v := range envs.envs {
+		if v.isList {
+			data[k] = v.list
+		} else {
+			data[k] = v.str
+		}
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(action.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+	err = writeFileAtomic(action.Dest, mode, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("write file failed: %w", err)
+	}
+	return nil
+}
+
+// templateBuiltins are predefined functions and keywords of text/template, they couldn't be overridden by filters.
+var templateBuiltins = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true, "len": true,
+	"not": true, "or": true, "print": true, "printf": true, "println": true, "urlquery": true,
+	"eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+
+	"block": true, "break": true, "continue": true, "define": true, "else": true, "end": true, "if": true,
+	"range": true, "template": true, "with": true, "nil": true, "true": true, "false": true,
+}
+
+// templateFuncs exposes expand filters as template functions, name must be valid identifier after
+// replacing '.' to '_', so aliases such as '?:' are skipped. builtin filters are added first, user defined
+// filters clashing with them or template builtins are skipped.
+func templateFuncs(envs *ExpandEnvs) template.FuncMap {
+	funcs := make(template.FuncMap)
+	addFunc := func(name string) {
+		funcName := strings.ReplaceAll(name, ".", "_")
+		if funcName == "" || templateBuiltins[funcName] {
+			return
+		}
+		if _, has := funcs[funcName]; has {
+			return
+		}
+		for _, c := range funcName {
+			if !isAlphaNum(c) {
+				return
+			}
+		}
+		funcs[funcName] = func(args ...interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("missing piped value of filter: %s", name)
+			}
+			var val envValue
+			switch v := args[len(args)-1].(type) {
+			case []string:
+				val = listValue(v)
+			default:
+				val = stringValue(fmt.Sprint(v))
+			}
+			filterArgs := []string{name}
+			for _, arg := range args[:len(args)-1] {
+				filterArgs = append(filterArgs, fmt.Sprint(arg))
+			}
+			res, err := envs.callFilter(strings.Join(filterArgs, " "), val, filterArgs)
+			if err != nil {
+				return nil, err
+			}
+			if res.isList {
+				return res.list, nil
+			}
+			return res.str, nil
+		}
+	}
+	for name := range expandFilters {
+		addFunc(name)
+	}
+	for name := range expandListFilters {
+		addFunc(name)
+	}
+	// sorted to skip clashing names such as 'a.b' and 'a_b' stably
+	names := make([]string, 0, len(envs.filters))
+	for name := range envs.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addFunc(name)
+	}
+	return funcs
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uiez/tash/syntax"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tash-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := filepath.Join(dir, "app.conf.tmpl")
+	dest := filepath.Join(dir, "app.conf")
+	err = ioutil.WriteFile(tmpl, []byte(`{{ .NAME | string_transform "upper" }} {{ len .NAME }} {{ .NAME | shout }}`), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(dest, []byte("old"), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envs := newExpandEnvs()
+	envs.set("NAME", "tash")
+	envs.filters = map[string]syntax.ExpandFilter{
+		"len":              {Pipeline: "string.transform lower"},
+		"string_transform": {Pipeline: "string.transform lower"},
+		"shout":            {Pipeline: "string.transform upper"},
+	}
+	err = renderTemplate(envs, syntax.ActionRender{Template: tmpl, Dest: dest, Mode: 0755})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	content, err := ioutil.ReadFile(dest)
+	if err != nil || string(content) != "TASH 4 TASH" {
+		t.Errorf("unexpected content: %q, %v", content, err)
+	}
+	stat, err := os.Stat(dest)
+	if err != nil || stat.Mode().Perm() != 0755 {
+		t.Errorf("mode of existing dest should be changed: %v, %v", stat.Mode(), err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 2 {
+		t.Errorf("temporary file should be removed: %v, %v", files, err)
+	}
+}
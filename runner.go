@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -126,7 +127,7 @@ func listTasks(configs *Configuration, log indentLogger, taskNames []string, sho
 	}
 }
 
-func runTasks(configs *Configuration, log indentLogger, names []string, args []string) {
+func runTasks(ws *workspace, log indentLogger, names []string, args []string, all bool) {
 	if len(names) == 0 {
 		log.fatalln("no tasks to run")
 		return
@@ -136,21 +137,47 @@ func runTasks(configs *Configuration, log indentLogger, names []string, args []s
 		log.fatalln("get current directory failed:", err)
 		return
 	}
+
+	type projectTask struct {
+		project *project
+		name    string
+		baseDir string
+	}
+	var tasks []projectTask
 	for _, name := range names {
-		_, has := configs.Tasks[name]
+		if all {
+			var found bool
+			for _, p := range ws.discover() {
+				if _, has := p.configs.Tasks[name]; has {
+					tasks = append(tasks, projectTask{project: p, name: name, baseDir: p.dir})
+					found = true
+				}
+			}
+			if !found {
+				log.fatalln("task not found in any project:", name)
+				return
+			}
+			continue
+		}
+		p, taskName, has := ws.resolveTask(name)
 		if !has {
 			log.fatalln("task not found:", name)
 			return
 		}
+		baseDir := currDir
+		if p != ws.root {
+			baseDir = p.dir
+		}
+		tasks = append(tasks, projectTask{project: p, name: taskName, baseDir: baseDir})
 	}
 
-	r := newRunner(nil, log, configs)
-	r.globalArgs = args
-	for i, name := range names {
+	for i, t := range tasks {
+		r := newRunner(nil, log, t.project.configs)
+		r.globalArgs = args
 		if i > 0 {
 			r.infoln() // create new line
 		}
-		r.runTaskByName(name, currDir)
+		r.runTaskByName(t.project.taskAddress(t.name), t.name, t.baseDir)
 	}
 }
 
@@ -162,6 +189,10 @@ type runner struct {
 	configs      *Configuration
 	noExitOnFail bool
 
+	// current action position and task/template stack, used for error reporting
+	pos    syntax.Position
+	frames []string
+
 	failed bool
 }
 
@@ -171,10 +202,52 @@ func newRunner(parent *runner, log indentLogger, configs *Configuration) *runner
 		indentLogger: log,
 		configs:      configs,
 	}
+	if parent != nil {
+		r.pos = parent.pos
+		r.frames = parent.frames
+	}
 	r.indentLogger.exit = r.doExit
 	return &r
 }
 
+// inherit copies error reporting context from another runner, used by standalone runners
+func (r *runner) inherit(from *runner) *runner {
+	r.pos = from.pos
+	r.frames = from.frames
+	return r
+}
+
+func (r *runner) pushFrame(kind, name string, pos syntax.Position) {
+	frame := fmt.Sprintf("%s '%s'", kind, name)
+	if pos.Line > 0 {
+		frame += fmt.Sprintf(" (%s)", pos)
+	}
+	r.frames = append(r.frames[:len(r.frames):len(r.frames)], frame)
+}
+
+func (r *runner) location() string {
+	var secs []string
+	if r.pos.Line > 0 {
+		secs = append(secs, "at "+r.pos.String())
+	}
+	if len(r.frames) > 0 {
+		frames := make([]string, len(r.frames))
+		for i, f := range r.frames {
+			frames[len(frames)-1-i] = f
+		}
+		secs = append(secs, "in "+strings.Join(frames, " <- "))
+	}
+	return strings.Join(secs, ", ")
+}
+
+func (r *runner) fatalln(v ...interface{}) {
+	if loc := r.location(); loc != "" {
+		msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+		v = []interface{}{msg + "\n" + r.indent + "    " + loc}
+	}
+	r.indentLogger.fatalln(v...)
+}
+
 func (r *runner) root() *runner {
 	rt := r
 	for rt.parent != nil {
@@ -219,21 +292,36 @@ func (r *runner) searchTemplate(name string) (syntax.ActionList, bool) {
 
 func (r *runner) createTaskEnvs(name string, task syntax.Task, workDir string) *ExpandEnvs {
 	envs := newExpandEnvs()
+	envs.filters = r.configs.Filters
 	r.debugln(">>>>> adds system environments")
-	envs.parsePairs(r.log(), os.Environ(), false)
+	sysEnvs := os.Environ()
+	if task.CleanEnv {
+		var inherited []string
+		for _, env := range sysEnvs {
+			k, _ := stringSplitAndTrimToPair(env, "=")
+			for _, name := range task.InheritEnv {
+				if k == name {
+					inherited = append(inherited, env)
+					break
+				}
+			}
+		}
+		sysEnvs = inherited
+	}
+	envs.parsePairs(r, sysEnvs, false)
 	r.debugln(">>>>> adds builtin environments")
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_WORKDIR, workDir, false)
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_HOST_OS, runtime.GOOS, false)
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_HOST_ARCH, runtime.GOARCH, false)
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_TASK_NAME, name, false)
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_PATHLISTSEP, string(os.PathListSeparator), false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_WORKDIR, workDir, false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_HOST_OS, runtime.GOOS, false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_HOST_ARCH, runtime.GOARCH, false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_TASK_NAME, name, false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_PATHLISTSEP, string(os.PathListSeparator), false)
 
 	userArgsEnv := envs.copy()
 	if len(r.root().globalArgs) > 0 {
 		r.debugln(">>>>> adds user provided arguments")
 		for _, a := range r.root().globalArgs {
 			blocks := splitBlocks(a)
-			userArgsEnv.parsePairs(r.log(), blocks, false)
+			userArgsEnv.parsePairs(r, blocks, false)
 		}
 	}
 	if len(task.Args) > 0 {
@@ -258,13 +346,13 @@ func (r *runner) createTaskEnvs(name string, task syntax.Task, workDir string) *
 				}
 				r.debugln("uses task argument default value:", arg.Env)
 			}
-			envs.addAndExpand(r.log(), arg.Env, val, false)
+			envs.addAndExpand(r, arg.Env, val, false)
 		}
 	}
 
 	if r.configs.Env.Length() > 0 {
 		r.debugln(">>>>> add configuration environments")
-		envs.parseEnv(r.log(), r.configs.Env)
+		envs.parseEnv(r, r.configs.Env, 0)
 	}
 
 	return envs
@@ -279,12 +367,13 @@ func (r *runner) runTask(name string, task syntax.Task, baseDir string) {
 	}
 
 	r.infoln("workdir:", workDir)
+	r.pushFrame("task", name, task.Pos)
 	envs := r.createTaskEnvs(name, task, workDir)
 	r.runActions(envs, task.Actions)
 }
 
-func (r *runner) runTaskByName(name, baseDir string) {
-	r.infoln("Task:", name)
+func (r *runner) runTaskByName(address, name, baseDir string) {
+	r.infoln("Task:", address)
 	task, ok := r.searchTask(name)
 	if !ok {
 		r.fatalln("task not found:", name)
@@ -299,6 +388,9 @@ func (r *runner) resourceNeedsSync(cpy syntax.ActionCopy, isLocalFile bool) bool
 	if err != nil {
 		return true
 	}
+	if cpy.Extract {
+		return isLocalFile
+	}
 	if info.IsDir() {
 		return true
 	}
@@ -312,7 +404,7 @@ func (r *runner) resourceNeedsSync(cpy syntax.ActionCopy, isLocalFile bool) bool
 	}
 	defer fd.Close()
 
-	return checkHash(r.log(), cpy.DestPath, cpy.Hash.Alg, cpy.Hash.Sig, fd)
+	return checkHash(r, cpy.DestPath, cpy.Hash.Alg, cpy.Hash.Sig, fd)
 }
 
 func (r *runner) resourceIsValid(res syntax.ActionCopy, path string) bool {
@@ -331,7 +423,20 @@ func (r *runner) resourceIsValid(res syntax.ActionCopy, path string) bool {
 	}
 	defer fd.Close()
 
-	return checkHash(r.log(), res.SourceUrl, res.Hash.Alg, res.Hash.Sig, fd)
+	return checkHash(r, res.SourceUrl, res.Hash.Alg, res.Hash.Sig, fd)
+}
+
+func copyActionOptions(cpy syntax.ActionCopy) copyOptions {
+	return copyOptions{
+		include:            cpy.Include,
+		exclude:            cpy.Exclude,
+		preserveSymlinks:   cpy.PreserveSymlinks,
+		ignoreSpecialFiles: cpy.IgnoreSpecialFiles,
+		sync:               cpy.Sync,
+		checksum:           cpy.Checksum,
+		delete:             cpy.Delete,
+		inPlace:            cpy.InPlace,
+	}
 }
 
 func (r *runner) runActionCopy(cpy syntax.ActionCopy, envs *ExpandEnvs) {
@@ -391,6 +496,19 @@ func (r *runner) runActionCopy(cpy syntax.ActionCopy, envs *ExpandEnvs) {
 			return
 		}
 	} else {
+		if isGlobPattern(cpy.SourceUrl) {
+			if cpy.Hash.Sig != "" {
+				r.fatalln("hash checking is not supported for multiple sources:", cpy.SourceUrl)
+				return
+			}
+			stats, err := copyGlobPaths(cpy.DestPath, cpy.SourceUrl, copyActionOptions(cpy))
+			if err != nil {
+				r.fatalln("resource copy failed:", cpy.SourceUrl, cpy.DestPath, err)
+				return
+			}
+			r.reportCopyStats(cpy, stats)
+			return
+		}
 		if !force && !r.resourceNeedsSync(cpy, true) {
 			r.debugln("resource reuse.")
 			return
@@ -406,11 +524,48 @@ func (r *runner) runActionCopy(cpy syntax.ActionCopy, envs *ExpandEnvs) {
 		r.fatalln("resource source invalid:", cpy.SourceUrl)
 		return
 	}
-	err := copyPath(cpy.DestPath, sourcePath)
+	if cpy.Extract {
+		opts := extractOptions{
+			stripComponents: cpy.StripComponents,
+			include:         cpy.Include,
+		}
+		// downloaded file has no extension, detect format by url
+		format, err := archiveFormat("", cpy.SourceUrl)
+		if err != nil {
+			r.fatalln(err)
+			return
+		}
+		opts.format = format
+		n, err := extractArchive(sourcePath, cpy.DestPath, opts)
+		if err != nil {
+			r.fatalln("resource extract failed:", cpy.SourceUrl, cpy.DestPath, err)
+			return
+		}
+		r.debugln("extracted entries:", n)
+		return
+	}
+	var (
+		stats copyStats
+		err   error
+	)
+	if cpy.Sync {
+		stats, err = syncPath(cpy.DestPath, sourcePath, copyActionOptions(cpy))
+	} else {
+		stats, err = copyPath(cpy.DestPath, sourcePath, copyActionOptions(cpy))
+	}
 	if err != nil {
 		r.fatalln("resource copy failed:", cpy.SourceUrl, cpy.DestPath, err)
 		return
 	}
+	r.reportCopyStats(cpy, stats)
+}
+
+func (r *runner) reportCopyStats(cpy syntax.ActionCopy, stats copyStats) {
+	if cpy.Sync {
+		r.infoln("synced:", stats)
+	} else {
+		r.debugln("copied:", stats)
+	}
 }
 
 func (r *runner) runActionTemplate(action string, envs *ExpandEnvs) {
@@ -419,20 +574,21 @@ func (r *runner) runActionTemplate(action string, envs *ExpandEnvs) {
 		r.fatalln("template not found:", action)
 		return
 	}
-	r.addIndent().runActions(envs, actions)
+	nr := r.addIndent()
+	nr.pushFrame("template", action, actions.Pos())
+	nr.runActions(envs, actions)
 }
 
 func (r *runner) runActionSwitch(action syntax.ActionSwitch, envs *ExpandEnvs) {
-	{
-		var n int
-		for compare := range action.Cases {
-			if compare == action.Default {
-				n++
+	cases := action.Cases.Cases()
+	defaultIndex := -1
+	for i, c := range cases {
+		if len(c.Match) == 1 && c.Match[0] == action.Default {
+			if defaultIndex >= 0 {
+				r.fatalln("multiple default cases is not allowed")
+				return
 			}
-		}
-		if n > 1 {
-			r.fatalln("multiple default cases is not allowed")
-			return
+			defaultIndex = i
 		}
 	}
 	value := action.Value
@@ -441,42 +597,89 @@ func (r *runner) runActionSwitch(action syntax.ActionSwitch, envs *ExpandEnvs) {
 		r.fatalln(err)
 		return
 	}
-	var defaultActions syntax.ActionList
-	for compare, actions := range action.Cases {
-		if compare == action.Default {
-			defaultActions = actions
-		} else {
+	operator := action.Operator
+	if a, has := syntax.OperatorAlias[operator]; has {
+		operator = a
+	}
+	matchIndex := -1
+	var matchValue string
+Cases:
+	for i, c := range cases {
+		if i == defaultIndex {
+			continue
+		}
+		for _, compare := range c.Match {
 			err := envs.expandStringPtrs(&compare)
 			if err != nil {
 				r.fatalln(err)
 				return
 			}
-			ok, err := checkCondition(envs, value, action.Operator, &compare)
+			ok, err := checkCondition(envs, value, operator, &compare)
 			if err != nil {
 				r.fatalln("check condition failed:", err)
 				return
 			}
 			if ok {
-				r.debugln("action switch case run:", compare)
-				r.addIndentIfDebug().runActions(envs, actions)
-				return
+				matchIndex = i
+				matchValue = compare
+				break Cases
 			}
 		}
 	}
-	if defaultActions.Length() > 0 {
+	// stale groups are cleared if it isn't matched by regexp
+	var groups []string
+	if matchIndex >= 0 && operator == syntax.Op_string_regexp {
+		groups = regexp.MustCompilePOSIX(matchValue).FindStringSubmatch(value)
+	}
+	err = setMatchEnvs(envs, groups)
+	if err != nil {
+		r.fatalln(err)
+		return
+	}
+	switch {
+	case matchIndex >= 0:
+		r.debugln("action switch case run:", matchValue)
+	case defaultIndex >= 0:
 		r.debugln("action switch run default case")
-		r.addIndent().runActions(envs, defaultActions)
-	} else {
+		matchIndex = defaultIndex
+	default:
 		r.debugln("action switch no case matched")
+		return
+	}
+	for i := matchIndex; i < len(cases) && !r.root().failed; i++ {
+		if i > matchIndex {
+			r.debugln("action switch fallthrough:", strings.Join(cases[i].Match, ", "))
+		}
+		if i == defaultIndex {
+			r.addIndent().runActions(envs, cases[i].Actions)
+		} else {
+			r.addIndentIfDebug().runActions(envs, cases[i].Actions)
+		}
+		if !cases[i].Fallthrough {
+			break
+		}
 	}
 }
 
-func (r *runner) runActionIf(action syntax.ActionIf, envs *ExpandEnvs) {
-	val, err := envs.expandString(action.Check)
-	if err != nil {
-		r.fatalln(err)
+// setMatchEnvs exports regexp capture groups as MATCH_0, MATCH_1..., stale groups of previous matching are removed.
+func setMatchEnvs(envs *ExpandEnvs, groups []string) error {
+	for i, g := range groups {
+		err := envs.set(syntax.BUILTIN_ENV_MATCH_PREFIX+strconv.Itoa(i), g)
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(groups); envs.Exist(syntax.BUILTIN_ENV_MATCH_PREFIX + strconv.Itoa(i)); i++ {
+		err := envs.unset(syntax.BUILTIN_ENV_MATCH_PREFIX + strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
 	}
-	ok, err := checkCondition(envs, val, "", nil)
+	return nil
+}
+
+func (r *runner) runActionIf(action syntax.ActionIf, envs *ExpandEnvs) {
+	ok, err := evalCondition(envs, action.Check)
 	if err != nil {
 		r.fatalln("check condition failed:", err)
 	}
@@ -514,29 +717,33 @@ func (r *runner) runActionLoop(action syntax.ActionLoop, envs *ExpandEnvs) {
 			}
 		}
 	case len(action.Array) > 0:
-		for i := range action.Array {
-			err := envs.expandStringPtrs(&action.Array[i])
+		// list values are flattened
+		var items []string
+		for _, item := range action.Array {
+			v, err := envs.expandValue(item)
 			if err != nil {
-				r.fatalln(err)
+				r.fatalln(fmt.Errorf("expand string failed: %s, %w", item, err))
 				return
 			}
+			if v.isList {
+				items = append(items, v.list...)
+			} else {
+				items = append(items, v.str)
+			}
 		}
 		looper = func(fn func(v string)) {
-			for _, v := range action.Array {
+			for _, v := range items {
 				fn(v)
 			}
 		}
 	case action.Split.Value != "":
-		err := envs.expandStringPtrs(&action.Split.Value)
+		v, err := envs.expandValue(action.Split.Value)
 		if err != nil {
-			r.fatalln(err)
+			r.fatalln(fmt.Errorf("expand string failed: %s, %w", action.Split.Value, err))
 			return
 		}
-		sep := action.Split.Separator
-		if sep == "" {
-			sep = " "
-		}
-		secs := stringSplitAndTrimFilterSpace(action.Split.Value, sep)
+		// list value is iterated directly, separator is used for string only
+		secs := v.elements(action.Split.Separator)
 		looper = func(fn func(v string)) {
 			for _, v := range secs {
 				fn(v)
@@ -546,29 +753,41 @@ func (r *runner) runActionLoop(action syntax.ActionLoop, envs *ExpandEnvs) {
 		r.fatalln("empty loop block")
 		return
 	}
+	if action.Var != "" && envs.isReadonly(action.Var) {
+		r.fatalln("env is readonly:", action.Var)
+		return
+	}
 	looper(func(v string) {
 		envs := envs
 		r := r.addIndentIfDebug()
 
 		var (
-			varEnvVal   string
+			varEnvVal   envValue
+			varEnvAttr  envAttr
 			varEnvExist bool
 		)
 		if action.Var != "" {
-			varEnvVal, varEnvExist = envs.get(action.Var)
-			envs.set(action.Var, v)
+			varEnvVal, varEnvExist = envs.getValue(action.Var)
+			varEnvAttr = envs.attrs[action.Var]
+			err := envs.set(action.Var, v)
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			envs.attrs[action.Var] = envLocal
 
 			r.debugln("loop run with var:", action.Var+"="+v)
 		}
 		r.runActions(envs, action.Actions)
 		if varEnvExist { // restore
-			envs.set(action.Var, varEnvVal)
+			envs.attrs[action.Var] = varEnvAttr
+			envs.setValue(action.Var, varEnvVal)
 		}
 	})
 }
 
 func (r *runner) runActionCmd(action syntax.ActionCmd, envs *ExpandEnvs, execs []string) {
-	envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_LAST_COMMAND_PID, "", false)
+	envs.addAndExpand(r, syntax.BUILTIN_ENV_LAST_COMMAND_PID, "", false)
 
 	var fds commandFds
 	var err error
@@ -612,7 +831,7 @@ func (r *runner) runActionCmd(action syntax.ActionCmd, envs *ExpandEnvs, execs [
 	if action.Env.Length() > 0 {
 		cmdEnvs = envs.copy()
 		r.debugln(">>>>> add command local environments")
-		cmdEnvs.parseEnv(r.log(), action.Env)
+		cmdEnvs.parseEnv(r, action.Env, 0)
 	}
 	for _, exec := range execs {
 		if exec != "" {
@@ -622,7 +841,7 @@ func (r *runner) runActionCmd(action syntax.ActionCmd, envs *ExpandEnvs, execs [
 				r.fatalln("run command failed:", err)
 				return
 			}
-			envs.addAndExpand(r.log(), syntax.BUILTIN_ENV_LAST_COMMAND_PID, strconv.Itoa(pid), false)
+			envs.addAndExpand(r, syntax.BUILTIN_ENV_LAST_COMMAND_PID, strconv.Itoa(pid), false)
 		}
 	}
 }
@@ -645,7 +864,7 @@ func (r *runner) runActionWatch(action syntax.ActionWatch, envs *ExpandEnvs) {
 
 	r.infoln("start watching.")
 	w.run(func() {
-		nr := newRunner(nil, r.log().addIndent(), r.configs)
+		nr := newRunner(nil, r.log().addIndent(), r.configs).inherit(r)
 		nr.noExitOnFail = true
 		nr.infoln("received fs changes, run watcher actions >>>>>>")
 		nr.runActions(envs, action.Actions)
@@ -752,14 +971,15 @@ func (r *runner) runActionTask(name string, passEnvs, returnEnvs []string, envs
 		r.fatalln("task not found:", name)
 		return
 	}
-	nr := newRunner(nil, r.log().addIndent(), r.configs)
+	nr := newRunner(nil, r.log().addIndent(), r.configs).inherit(r)
 	nr.noExitOnFail = true
+	nr.pushFrame("task", name, task.Pos)
 
 	taskEnvs := r.createTaskEnvs(name, task, wd)
 	transferEnvs := func(from, to *ExpandEnvs, envs []string) {
 		for _, env := range envs {
-			v, _ := from.lookupAndFilter(env, nil)
-			to.addAndExpand(nr.log(), env, v, false)
+			v, _ := from.getValue(env)
+			to.addValue(nr, env, v)
 		}
 	}
 	transferEnvs(envs, taskEnvs, passEnvs)
@@ -791,14 +1011,39 @@ func (r *runner) expandPathBlockAndGlob(path string, envs *ExpandEnvs, mustBeFil
 	return matched, true
 }
 
+// expandSourcePaths expands and globs source paths, multiple is set if it's glob pattern or multiple blocks.
+// it fails if nothing matched, non-existing path is kept if allowNonExist is set and it isn't glob.
+func (r *runner) expandSourcePaths(path string, envs *ExpandEnvs, allowNonExist bool) ([]string, bool, bool) {
+	err := envs.expandStringPtrs(&path)
+	if err != nil {
+		r.fatalln(err)
+		return nil, false, false
+	}
+	path = filepath.ToSlash(path)
+	multiple := isGlobPattern(path)
+	if !multiple {
+		path = strings.TrimSpace(path)
+		if _, err := os.Lstat(path); err == nil || allowNonExist {
+			return []string{path}, false, true
+		}
+	}
+	matched, err := splitBlocksAndGlobPath(path, false)
+	if err != nil {
+		r.fatalln("glob path failed:", err)
+		return nil, false, false
+	}
+	if len(matched) == 0 {
+		r.fatalln("no source path matched:", path)
+		return nil, false, false
+	}
+	return matched, multiple, true
+}
+
 func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 	for _, a := range a.Actions() {
+		r.pos = a.Pos
 		if a.On != "" {
-			val, err := envs.expandString(a.On)
-			if err != nil {
-				r.fatalln(err)
-			}
-			ok, err := checkCondition(envs, val, "", nil)
+			ok, err := evalCondition(envs, a.On)
 			if err != nil {
 				r.fatalln("check condition failed:", err)
 			}
@@ -818,10 +1063,40 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 		}
 		next(a.Env.Length() > 0, func() {
 			r.debugln("Env")
-			envs.parseEnv(r.addIndentIfDebug().log(), a.Env)
+			envs.parseEnv(r.addIndentIfDebug(), a.Env, 0)
+		})
+		next(a.Local.Length() > 0, func() {
+			r.debugln("Local")
+			envs.parseEnv(r.addIndentIfDebug(), a.Local, envLocal)
+		})
+		next(a.Readonly.Length() > 0, func() {
+			r.debugln("Readonly")
+			envs.parseEnv(r.addIndentIfDebug(), a.Readonly, envReadonly)
+		})
+		next(a.Unset != "", func() {
+			err := envs.expandStringPtrs(&a.Unset)
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			names := splitBlocks(a.Unset)
+			r.debugln("Unset:", names)
+			for _, name := range names {
+				err = envs.unset(name)
+				if err != nil {
+					r.fatalln(err)
+					return
+				}
+			}
 		})
 		next(a.Cmd.Exec != "", func() {
-			err := envs.expandStringPtrs(&a.Cmd.Exec, &a.Cmd.WorkDir, &a.Cmd.Stdin, &a.Cmd.Stdout, &a.Cmd.Stderr)
+			exec, err := envs.expandCommand(a.Cmd.Exec)
+			if err != nil {
+				r.fatalln(fmt.Errorf("expand string failed: %s, %w", a.Cmd.Exec, err))
+				return
+			}
+			a.Cmd.Exec = exec
+			err = envs.expandStringPtrs(&a.Cmd.WorkDir, &a.Cmd.Stdin, &a.Cmd.Stdout, &a.Cmd.Stderr)
 			if err != nil {
 				r.fatalln(err)
 				return
@@ -836,6 +1111,17 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 			if err != nil {
 				r.fatalln(err)
 			}
+			// slices are shared with configuration, copy them before expanding
+			a.Copy.Exclude = append([]string(nil), a.Copy.Exclude...)
+			a.Copy.Include = append([]string(nil), a.Copy.Include...)
+			err = envs.expandStringSlice(a.Copy.Exclude)
+			if err == nil {
+				err = envs.expandStringSlice(a.Copy.Include)
+			}
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
 			ptrsToSlash(&a.Copy.SourceUrl, &a.Copy.DestPath)
 			r.infoln("Copy:", a.Copy.SourceUrl, a.Copy.DestPath)
 			r.addIndentIfDebug().runActionCopy(a.Copy, envs)
@@ -863,7 +1149,7 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 			}
 			r.infoln("Replace:", matched)
 			r.debugln("Replacements:", a.Replace.Replaces)
-			replacer, err := fileReplacer(a.Replace.Replaces, a.Replace.Regexp)
+			replacer, err := fileReplacer(a.Replace.Replaces, a.Replace.Regexp, a.Replace.InPlace)
 			if err != nil {
 				r.fatalln("build replacer failed:", err)
 				return
@@ -931,7 +1217,7 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 				r.runActionTemplate(template, envs)
 			}
 		})
-		next(len(a.Switch.Cases) > 0, func() {
+		next(a.Switch.Cases.Length() > 0, func() {
 			r.debugln("Switch")
 			r.runActionSwitch(a.Switch, envs)
 		})
@@ -968,6 +1254,16 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 				return
 			}
 			r.infoln("Echo:", a.Echo.File)
+			if !a.Echo.Append && !a.Echo.InPlace {
+				err = writeFileAtomic(a.Echo.File, 0, func(w io.Writer) error {
+					_, err := io.WriteString(w, a.Echo.Content)
+					return err
+				})
+				if err != nil {
+					r.fatalln("write file failed:", err)
+				}
+				return
+			}
 			func() {
 				fd, err := openFile(a.Echo.File, a.Echo.Append)
 				if err != nil {
@@ -981,6 +1277,108 @@ func (r *runner) runActions(envs *ExpandEnvs, a syntax.ActionList) {
 				}
 			}()
 		})
+		next(a.Render.Template != "", func() {
+			err := envs.expandStringPtrs(&a.Render.Template, &a.Render.Dest)
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			r.infoln("Render:", a.Render.Template, "->", a.Render.Dest)
+			err = renderTemplate(envs, a.Render)
+			if err != nil {
+				r.fatalln("render template failed:", err)
+			}
+		})
+		next(a.Archive.Dest != "", func() {
+			err := envs.expandStringPtrs(&a.Archive.Format, &a.Archive.Dest, &a.Archive.Prefix)
+			if err == nil {
+				a.Archive.Exclude = append([]string(nil), a.Archive.Exclude...)
+				err = envs.expandStringSlice(a.Archive.Exclude)
+			}
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			paths, ok := r.expandPathBlockAndGlob(a.Archive.Src, envs, false)
+			if !ok {
+				return
+			}
+			if len(paths) == 0 {
+				r.fatalln("no source path matched:", a.Archive.Src)
+				return
+			}
+			r.infoln("Archive:", paths, "->", a.Archive.Dest)
+			n, err := createArchive(envs, a.Archive, paths)
+			if err != nil {
+				r.fatalln("create archive failed:", err)
+				return
+			}
+			r.debugln("archived entries:", n)
+		})
+		next(a.Extract.Src != "", func() {
+			err := envs.expandStringPtrs(&a.Extract.Format, &a.Extract.Src, &a.Extract.Dest)
+			if err == nil {
+				a.Extract.Include = append([]string(nil), a.Extract.Include...)
+				err = envs.expandStringSlice(a.Extract.Include)
+			}
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			ptrsToSlash(&a.Extract.Src, &a.Extract.Dest)
+			r.infoln("Extract:", a.Extract.Src, "->", a.Extract.Dest)
+			n, err := extractArchive(a.Extract.Src, a.Extract.Dest, extractOptions{
+				format:          a.Extract.Format,
+				stripComponents: a.Extract.StripComponents,
+				include:         a.Extract.Include,
+			})
+			if err != nil {
+				r.fatalln("extract archive failed:", err)
+				return
+			}
+			r.debugln("extracted entries:", n)
+		})
+		next(a.Move.Src != "", func() {
+			err := envs.expandStringPtrs(&a.Move.Dest)
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			ptrsToSlash(&a.Move.Dest)
+			matched, multiple, ok := r.expandSourcePaths(a.Move.Src, envs, false)
+			if !ok {
+				return
+			}
+			r.infoln("Move:", matched, "->", a.Move.Dest)
+			for _, m := range matched {
+				err := movePath(m, destPath(m, a.Move.Dest, multiple), a.Move.Overwrite)
+				if err != nil {
+					r.fatalln("move path failed:", m, err)
+					return
+				}
+			}
+		})
+		next(a.Link.Path != "", func() {
+			err := envs.expandStringPtrs(&a.Link.Path)
+			if err != nil {
+				r.fatalln(err)
+				return
+			}
+			ptrsToSlash(&a.Link.Path)
+			// dangling symbolic link is allowed
+			matched, multiple, ok := r.expandSourcePaths(a.Link.Target, envs, a.Link.Symbolic)
+			if !ok {
+				return
+			}
+			r.infoln("Link:", matched, "->", a.Link.Path)
+			for _, m := range matched {
+				err := linkPath(m, destPath(m, a.Link.Path, multiple), a.Link.Symbolic, a.Link.Relative, a.Link.Force)
+				if err != nil {
+					r.fatalln("create link failed:", m, err)
+					return
+				}
+			}
+		})
 		next(a.Task.Name != "", func() {
 			err := envs.expandStringPtrs(&a.Task.Name)
 			if err != nil {
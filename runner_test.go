@@ -0,0 +1,348 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/uiez/tash/syntax"
+)
+
+// runTestActions decodes yaml action list and runs it, the runner doesn't exit on failure.
+func runTestActions(t *testing.T, envs *ExpandEnvs, content string) *runner {
+	var actions syntax.ActionList
+	err := unmarshalConfiguration("tash.yaml", "tash.yaml", []byte(content), &actions)
+	if err != nil {
+		t.Fatalf("decode actions failed: %v", err)
+	}
+	r := newRunner(nil, newLogger(false), &Configuration{})
+	r.noExitOnFail = true
+	r.runActions(envs, actions)
+	return r
+}
+
+func TestLoopListElements(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		loop string
+		want string
+	}{
+		{`array: [$L]`, "[a b][c'd]"},
+		{`array: [$L, "e f"]`, "[a b][c'd][e f]"},
+		{`array: ["${L | array.reverse}"]`, "[c'd][a b]"},
+		{`split: {value: $L, separator: "'"}`, "[a b][c'd]"},
+		{`split: {value: $S}`, "[x][y]"},
+		{`split: {value: "$L"}`, "[a b][c'd]"},
+		{`array: ["x$L"]`, "[xa b c'd]"},
+	}
+	for i, c := range cases {
+		e := newTestListEnvs()
+		out := filepath.Join(dir, "out"+string(rune('a'+i)))
+		e.set("OUT", filepath.ToSlash(out))
+		r := runTestActions(t, e, `
+- loop:
+    var: F
+    `+c.loop+`
+    actions:
+      - echo: {file: $OUT, content: "[$F]", append: true}
+`)
+		if r.failed {
+			t.Errorf("loop %s failed", c.loop)
+			continue
+		}
+		content, err := ioutil.ReadFile(out)
+		if err != nil || string(content) != c.want {
+			t.Errorf("loop %s: want %q, got %q, %v", c.loop, c.want, content, err)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, file string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestEnvReadonly(t *testing.T) {
+	e := newExpandEnvs()
+	r := runTestActions(t, e, `
+- readonly: R=1
+- env: A=2
+- readonly: A
+`)
+	if r.failed {
+		t.Fatalf("define readonly envs failed")
+	}
+	for _, k := range []string{"R", "A"} {
+		if err := e.set(k, "x"); err == nil {
+			t.Errorf("set readonly %s should fail", k)
+		}
+		if err := e.unset(k); err == nil {
+			t.Errorf("unset readonly %s should fail", k)
+		}
+	}
+	if v, _ := e.get("R"); v != "1" {
+		t.Errorf("readonly env is changed: %s", v)
+	}
+
+	for _, actions := range []string{
+		`- env: R=2`,
+		`- local: R=2`,
+		`- unset: R`,
+		`- readonly: R=2`,
+		`- loop: {var: R, times: 1, actions: [{env: A=1}]}`,
+		`- loop: {var: F, array: [a, b], actions: [{readonly: F}]}`,
+		`- readonly: MATCH_1=x
+- switch: {value: abc, operator: string.regexp, cases: [{match: ["a(b)c"], actions: [{env: A=1}]}]}`,
+		`- readonly: MATCH_2=x
+- switch: {value: abc, operator: string.regexp, cases: [{match: ["a(b)c"], actions: [{env: A=1}]}]}`,
+	} {
+		e := newExpandEnvs()
+		e.set("R", "1")
+		e.attrs["R"] = envReadonly
+		if r := runTestActions(t, e, actions); !r.failed {
+			t.Errorf("readonly env is changed by %s", actions)
+		}
+	}
+
+	if err := setMatchEnvs(e, []string{"abc", "b"}); err != nil {
+		t.Errorf("set match envs failed: %v", err)
+	}
+	e.attrs["MATCH_1"] = envReadonly
+	if err := setMatchEnvs(e, []string{"abc"}); err == nil {
+		t.Errorf("stale readonly match env shouldn't be removed")
+	}
+}
+
+func TestEnvLocalAndUnset(t *testing.T) {
+	dir := t.TempDir()
+	path := os.Getenv("PATH")
+	t.Cleanup(func() {
+		os.Setenv("PATH", path)
+	})
+
+	e := newExpandEnvs()
+	e.set("PATH", path)
+	e.set("OUT", filepath.ToSlash(dir))
+	r := runTestActions(t, e, `
+- env: |
+    PUBLIC=1
+    REMOVED=1
+- local: SECRET=2
+- local: REMOVED
+- loop:
+    var: F
+    array: [a]
+    actions:
+      - cmd: {exec: env, stdout: $OUT/loop}
+- unset: REMOVED
+- echo: {file: $OUT/expanded, content: "$PUBLIC,$SECRET,$REMOVED,$F"}
+- cmd: {exec: env, stdout: $OUT/env}
+`)
+	if r.failed {
+		t.Fatalf("run actions failed")
+	}
+	if got := readTestFile(t, filepath.Join(dir, "expanded")); got != "1,2,,a" {
+		t.Errorf("local env should be expanded, unset env should be empty: %q", got)
+	}
+	for _, file := range []string{"loop", "env"} {
+		envs := strings.Split(readTestFile(t, filepath.Join(dir, file)), "\n")
+		has := func(prefix string) bool {
+			for _, env := range envs {
+				if strings.HasPrefix(env, prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		if !has("PUBLIC=1") || !has("PATH=") {
+			t.Errorf("%s: exported envs are missing: %q", file, envs)
+		}
+		for _, name := range []string{"SECRET=", "REMOVED=", "F="} {
+			if has(name) {
+				t.Errorf("%s: local env is exported: %s", file, name)
+			}
+		}
+	}
+
+	// executables couldn't be found after PATH is unset
+	r = runTestActions(t, e, `
+- unset: PATH
+- cmd: {exec: env}
+`)
+	if !r.failed {
+		t.Errorf("command should fail after PATH is unset")
+	}
+	if _, has := os.LookupEnv("PATH"); has {
+		t.Errorf("PATH isn't removed from process environments")
+	}
+}
+
+func TestCreateTaskEnvs(t *testing.T) {
+	t.Setenv("TASH_TEST_INHERITED", "1")
+	t.Setenv("TASH_TEST_SYSTEM", "2")
+	cases := []struct {
+		task syntax.Task
+		want map[string]bool
+	}{
+		{syntax.Task{}, map[string]bool{"TASH_TEST_INHERITED": true, "TASH_TEST_SYSTEM": true}},
+		{syntax.Task{CleanEnv: true}, map[string]bool{"TASH_TEST_INHERITED": false, "TASH_TEST_SYSTEM": false}},
+		{
+			syntax.Task{CleanEnv: true, InheritEnv: []string{"TASH_TEST_INHERITED", "TASH_TEST_MISSING"}},
+			map[string]bool{"TASH_TEST_INHERITED": true, "TASH_TEST_SYSTEM": false, "TASH_TEST_MISSING": false},
+		},
+		// inherited envs are ignored if CleanEnv isn't set
+		{syntax.Task{InheritEnv: []string{"TASH_TEST_INHERITED"}}, map[string]bool{"TASH_TEST_SYSTEM": true}},
+	}
+	for _, c := range cases {
+		r := newRunner(nil, newLogger(false), &Configuration{})
+		r.noExitOnFail = true
+		envs := r.createTaskEnvs("test", c.task, "/work")
+		for name, want := range c.want {
+			if envs.Exist(name) != want {
+				t.Errorf("clean %v inherit %v: env %s should exist: %v", c.task.CleanEnv, c.task.InheritEnv, name, want)
+			}
+		}
+		// builtin envs are always defined
+		if v, _ := envs.get(syntax.BUILTIN_ENV_WORKDIR); v != "/work" {
+			t.Errorf("clean %v inherit %v: unexpected WORKDIR: %q", c.task.CleanEnv, c.task.InheritEnv, v)
+		}
+		if r.failed {
+			t.Errorf("clean %v inherit %v: create task envs failed", c.task.CleanEnv, c.task.InheritEnv)
+		}
+	}
+}
+
+func TestSwitchCases(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		desc    string
+		value   string
+		actions string
+		want    string
+	}{
+		{"first matched case", "src/a.go", `
+    operator: string.glob
+    cases:
+      - {match: "src/*", actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+      - {match: "src/a.go", actions: [{echo: {file: $OUT, content: 2, append: true}}]}
+`, "1"},
+		{"glob doesn't match separator", "src/a.go", `
+    operator: string.glob
+    cases:
+      - {match: "*.go", actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+      - {match: "*/?.go", actions: [{echo: {file: $OUT, content: 2, append: true}}]}
+`, "2"},
+		{"list valued case", "b", `
+    cases:
+      - {match: [a, "$V", c], actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+      - {match: b, actions: [{echo: {file: $OUT, content: 2, append: true}}]}
+`, "1"},
+		{"mapping cases keep order", "5", `
+    operator: number.lessThan
+    cases:
+      "9": [{echo: {file: $OUT, content: 1, append: true}}]
+      "7": [{echo: {file: $OUT, content: 2, append: true}}]
+`, "1"},
+		{"default case", "x", `
+    default: _
+    cases:
+      - {match: _, actions: [{echo: {file: $OUT, content: d, append: true}}]}
+      - {match: x, actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+`, "1"},
+		{"default case not matched", "y", `
+    default: _
+    cases:
+      - {match: _, actions: [{echo: {file: $OUT, content: d, append: true}}]}
+      - {match: x, actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+`, "d"},
+		{"no case matched", "y", `
+    cases:
+      - {match: x, actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+`, ""},
+		{"fallthrough", "a", `
+    default: _
+    cases:
+      - {match: a, fallthrough: true, actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+      - {match: b, fallthrough: true, actions: [{echo: {file: $OUT, content: 2, append: true}}]}
+      - {match: _, actions: [{echo: {file: $OUT, content: d, append: true}}]}
+      - {match: c, actions: [{echo: {file: $OUT, content: 3, append: true}}]}
+`, "12d"},
+		{"fallthrough from default", "x", `
+    default: _
+    cases:
+      - {match: _, fallthrough: true, actions: [{echo: {file: $OUT, content: d, append: true}}]}
+      - {match: a, actions: [{echo: {file: $OUT, content: 1, append: true}}]}
+      - {match: b, actions: [{echo: {file: $OUT, content: 2, append: true}}]}
+`, "d1"},
+		{"regexp groups", "v1.2", `
+    operator: string.regexp
+    cases:
+      - {match: "^v([0-9]+)\\.([0-9]+)$", actions: [{echo: {file: $OUT, content: "$MATCH_0,$MATCH_1,$MATCH_2", append: true}}]}
+`, "v1.2,1,2"},
+	}
+	for i, c := range cases {
+		out := filepath.Join(dir, strconv.Itoa(i))
+		e := newExpandEnvs()
+		e.set("OUT", filepath.ToSlash(out))
+		e.set("V", "b")
+		r := runTestActions(t, e, `
+- echo: {file: $OUT, content: ""}
+- switch:
+    value: `+c.value+c.actions)
+		if r.failed {
+			t.Errorf("%s: switch failed", c.desc)
+			continue
+		}
+		if got := readTestFile(t, out); got != c.want {
+			t.Errorf("%s: want %q, got %q", c.desc, c.want, got)
+		}
+	}
+
+	r := runTestActions(t, newExpandEnvs(), `
+- switch:
+    value: a
+    default: _
+    cases:
+      - {match: _, actions: [{env: A=1}]}
+      - {match: _, actions: [{env: A=2}]}
+`)
+	if !r.failed {
+		t.Errorf("multiple default cases should fail")
+	}
+}
+
+func TestSwitchMatchEnvsCleared(t *testing.T) {
+	dir := t.TempDir()
+	for _, second := range []string{
+		// not matched
+		`{value: abc, operator: string.regexp, cases: [{match: "x(y)", actions: [{env: A=1}]}]}`,
+		// matched by other operator
+		`{value: abc, cases: [{match: abc, actions: [{env: A=1}]}]}`,
+		// default case
+		`{value: abc, default: _, cases: [{match: _, actions: [{env: A=1}]}]}`,
+	} {
+		e := newExpandEnvs()
+		out := filepath.Join(dir, "out")
+		e.set("OUT", filepath.ToSlash(out))
+		r := runTestActions(t, e, `
+- switch: {value: abc, operator: string.regexp, cases: [{match: "a(b)(c)", actions: [{env: A=1}]}]}
+- echo: {file: $OUT, content: "[$MATCH_0,$MATCH_2]"}
+- switch: `+second+`
+- echo: {file: $OUT, content: "[$MATCH_0,$MATCH_2]", append: true}
+`)
+		if r.failed {
+			t.Errorf("switch %s failed", second)
+			continue
+		}
+		if got := readTestFile(t, out); got != "[abc,c][,]" {
+			t.Errorf("switch %s: match envs aren't cleared: %q", second, got)
+		}
+	}
+}
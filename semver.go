@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is semantic version 2.0, minor and patch could be omitted in parsing.
+type semver struct {
+	prefix     string
+	major      uint64
+	minor      uint64
+	patch      uint64
+	prerelease []string
+	build      string
+}
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	if strings.HasPrefix(s, "v") || strings.HasPrefix(s, "V") {
+		v.prefix = s[:1]
+		s = s[1:]
+	}
+	if idx := strings.Index(s, "+"); idx >= 0 {
+		v.build = s[idx+1:]
+		s = s[:idx]
+	}
+	if idx := strings.Index(s, "-"); idx >= 0 {
+		pre := s[idx+1:]
+		s = s[:idx]
+		if pre == "" {
+			return v, fmt.Errorf("empty pre-release version")
+		}
+		v.prerelease = strings.Split(pre, ".")
+		for _, id := range v.prerelease {
+			if id == "" {
+				return v, fmt.Errorf("empty pre-release identifier")
+			}
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("too many version numbers: %s", s)
+	}
+	nums := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid version number: %s", p)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.prefix, v.major, v.minor, v.patch)
+	if len(v.prerelease) > 0 {
+		s += "-" + strings.Join(v.prerelease, ".")
+	}
+	if v.build != "" {
+		s += "+" + v.build
+	}
+	return s
+}
+
+// bump increases version part, pre-release version is bumped to it's release version if possible, such as
+// 1.2.0-rc.1 to 1.2.0 for minor bumping, build metadata is dropped.
+func (v semver) bump(part string) (semver, error) {
+	isPre := len(v.prerelease) > 0
+	switch part {
+	case "major":
+		if !isPre || v.minor != 0 || v.patch != 0 {
+			v.major++
+		}
+		v.minor = 0
+		v.patch = 0
+	case "minor":
+		if !isPre || v.patch != 0 {
+			v.minor++
+		}
+		v.patch = 0
+	case "patch":
+		if !isPre {
+			v.patch++
+		}
+	default:
+		return v, fmt.Errorf("invalid version part: %s", part)
+	}
+	v.prerelease = nil
+	v.build = ""
+	return v, nil
+}
+
+// compareSemver compares versions by precedence, build metadata is ignored.
+func compareSemver(v1, v2 semver) int {
+	compareUint := func(a, b uint64) int {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if c := compareUint(v1.major, v2.major); c != 0 {
+		return c
+	}
+	if c := compareUint(v1.minor, v2.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v1.patch, v2.patch); c != 0 {
+		return c
+	}
+	// a pre-release version has lower precedence than the normal version
+	switch {
+	case len(v1.prerelease) == 0 && len(v2.prerelease) == 0:
+		return 0
+	case len(v1.prerelease) == 0:
+		return 1
+	case len(v2.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v1.prerelease) && i < len(v2.prerelease); i++ {
+		id1, id2 := v1.prerelease[i], v2.prerelease[i]
+		n1, err1 := strconv.ParseUint(id1, 10, 64)
+		n2, err2 := strconv.ParseUint(id2, 10, 64)
+		var c int
+		switch {
+		case err1 == nil && err2 == nil:
+			c = compareUint(n1, n2)
+		case err1 == nil:
+			// numeric identifiers have lower precedence than alphanumeric identifiers
+			c = -1
+		case err2 == nil:
+			c = 1
+		default:
+			c = strings.Compare(id1, id2)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v1.prerelease)), uint64(len(v2.prerelease)))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+		fail bool
+	}{
+		{s: "1.2.3", want: "1.2.3"},
+		{s: "v1.2.3", want: "v1.2.3"},
+		{s: "V2", want: "V2.0.0"},
+		{s: "1.2", want: "1.2.0"},
+		{s: "1.2.3-rc.1+build.5", want: "1.2.3-rc.1+build.5"},
+		{s: "1.0.0+20130313144700", want: "1.0.0+20130313144700"},
+		{s: "1.0.0-x-y.z", want: "1.0.0-x-y.z"},
+		{s: "1.2.3.4", fail: true},
+		{s: "1.a.3", fail: true},
+		{s: "1.2.3-", fail: true},
+		{s: "1.2.3-rc..1", fail: true},
+		{s: "", fail: true},
+	}
+	for _, c := range cases {
+		v, err := parseSemver(c.s)
+		if c.fail {
+			if err == nil {
+				t.Errorf("parse %q: want error, got %s", c.s, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse %q failed: %v", c.s, err)
+			continue
+		}
+		if v.String() != c.want {
+			t.Errorf("parse %q: want %s, got %s", c.s, c.want, v)
+		}
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	// ordered by precedence, from SemVer 2.0 specification
+	ordered := []string{
+		"1.0.0-1",
+		"1.0.0-2",
+		"1.0.0-10",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1-0",
+		"1.0.1",
+		"1.9.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			v1, err1 := parseSemver(ordered[i])
+			v2, err2 := parseSemver(ordered[j])
+			if err1 != nil || err2 != nil {
+				t.Fatalf("parse %s, %s failed: %v, %v", ordered[i], ordered[j], err1, err2)
+			}
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := compareSemver(v1, v2); got != want {
+				t.Errorf("compare %s %s: want %d, got %d", ordered[i], ordered[j], want, got)
+			}
+		}
+	}
+
+	for _, pair := range [][2]string{
+		{"1.2.3", "v1.2.3"},
+		{"1.2", "1.2.0"},
+		{"1.2.3+a", "1.2.3+b"},
+		{"1.2.3-rc.1+a", "1.2.3-rc.1"},
+	} {
+		v1, _ := parseSemver(pair[0])
+		v2, _ := parseSemver(pair[1])
+		if c := compareSemver(v1, v2); c != 0 {
+			t.Errorf("compare %s %s: want equal, got %d", pair[0], pair[1], c)
+		}
+	}
+}
+
+func TestSemverFilters(t *testing.T) {
+	runFilterTests(t, "semver.bump", []filterTestCase{
+		{input: "1.2.3", args: []string{"major"}, want: "2.0.0"},
+		{input: "1.2.3", args: []string{"minor"}, want: "1.3.0"},
+		{input: "1.2.3", args: []string{"patch"}, want: "1.2.4"},
+		{input: "v1.2.3+build", args: []string{"patch"}, want: "v1.2.4"},
+		// pre-release is dropped, it's bumped to release version if possible
+		{input: "2.0.0-rc.1", args: []string{"major"}, want: "2.0.0"},
+		{input: "1.2.0-rc.1", args: []string{"major"}, want: "2.0.0"},
+		{input: "1.2.0-rc.1", args: []string{"minor"}, want: "1.2.0"},
+		{input: "1.2.3-rc.1", args: []string{"minor"}, want: "1.3.0"},
+		{input: "1.2.3-rc.1", args: []string{"patch"}, want: "1.2.3"},
+		{input: "1.2.3-alpha+build", args: []string{"patch"}, want: "1.2.3"},
+		{input: "1.2.3", args: []string{"build"}, fail: true},
+		{input: "1.2.3", args: nil, fail: true},
+		{input: "x.y", args: []string{"major"}, fail: true},
+	})
+	runFilterTests(t, "semver.major", []filterTestCase{
+		{input: "v3.2.1", want: "3"},
+		{input: "3.2.1", args: []string{"x"}, fail: true},
+	})
+	runFilterTests(t, "semver.minor", []filterTestCase{
+		{input: "3.2.1", want: "2"},
+		{input: "3", want: "0"},
+	})
+	runFilterTests(t, "semver.patch", []filterTestCase{
+		{input: "3.2.1-rc.1", want: "1"},
+	})
+	runFilterTests(t, "semver.prerelease", []filterTestCase{
+		{input: "3.2.1-rc.1+build", want: "rc.1"},
+		{input: "3.2.1", want: ""},
+		{input: "3.2.1-", fail: true},
+	})
+	runFilterTests(t, "semver.sort", []filterTestCase{
+		{input: "1.10.0 1.0.0 1.0.0-rc.1 1.0.0-beta.11 1.0.0-beta.2 v1.9.0", want: "1.0.0-beta.2 1.0.0-beta.11 1.0.0-rc.1 1.0.0 v1.9.0 1.10.0"},
+		{input: "1.0.0-alpha.beta,1.0.0-alpha.1,1.0.0-alpha", args: []string{","}, want: "1.0.0-alpha,1.0.0-alpha.1,1.0.0-alpha.beta"},
+		// sorting is stable for equal versions
+		{input: "1.0.0+b 1.0.0+a 1.0", want: "1.0.0+b 1.0.0+a 1.0"},
+		{input: "1.0.0 latest", fail: true},
+	})
+}
+
+func TestSemverConditions(t *testing.T) {
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"1.10.0 -vgt 1.9.0", true},
+		{"1.10.0 -vlt 1.9.0", false},
+		{"1.0.0-rc.1 -vlt 1.0.0", true},
+		{"1.0.0-alpha.1 -vlt 1.0.0-alpha.beta", true},
+		{"1.0.0-beta.11 -vgt 1.0.0-beta.2", true},
+		{"v1.2 -veq 1.2.0+build", true},
+		{"1.2.3 -vge 1.2.3 && 1.2.3 -vle 1.2.3", true},
+		{"1.2.3 -vne 1.2.3-0", true},
+		{"$V -vgt 1.2.3 && $V -vlt 1.3", true},
+	}
+	for _, c := range cases {
+		e := newExpandEnvs()
+		e.set("V", "1.2.4-rc.1")
+		got, err := evalCondition(e, c.expr)
+		if err != nil {
+			t.Errorf("eval %q failed: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("eval %q: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+	for _, expr := range []string{"1.2.3 -vgt latest", "x -vlt 1.0.0"} {
+		if _, err := evalCondition(newExpandEnvs(), expr); err == nil {
+			t.Errorf("eval %q: invalid version should be reported", expr)
+		}
+	}
+}
@@ -4,6 +4,12 @@ package syntax
 type contextActions struct {
 	// define environments
 	Env ActionEnv
+	// define environments not exported to child processes, loop variables are also local
+	Local ActionEnv
+	// define environments couldn't be reassigned or unset
+	Readonly ActionEnv
+	// remove environments
+	Unset ActionUnset
 	// change current working directory
 	Chdir ActionChdir
 	// silent logs or errors, same as '-' and '@' in makefile.
@@ -11,8 +17,13 @@ type contextActions struct {
 }
 
 // environment definition
+// for Local and Readonly, entry without value changes attribute of existing environment,
+// attributes are kept on reassignment.
 type ActionEnv = EnvList
 
+// environment names, could be text block
+type ActionUnset = string
+
 const (
 	SilentFlagAllowError = "allowError"
 	SilentFlagShowLog    = "showLog"
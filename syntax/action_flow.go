@@ -1,5 +1,11 @@
 package syntax
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 // flow control actions
 type flowActions struct {
 	// sugar for condition running
@@ -14,12 +20,71 @@ type flowActions struct {
 type ActionSwitch struct {
 	Value    string
 	Operator string
-	Default  string
-	Cases    map[string]ActionList
+	// match value of default case
+	Default string
+	// cases are checked in order, the first matched case is run.
+	// for regexp operator, capture groups of matched case are exported as MATCH_0(whole match), MATCH_1...,
+	// they are cleared for other operators or if no case is matched.
+	Cases SwitchCases
+}
+
+// SwitchCases: could be mapping of match value to actions, or list of SwitchCase,
+// cases keep the order in config file.
+type SwitchCases struct {
+	cases []SwitchCase
+}
+
+type SwitchCase struct {
+	// match values, case is matched if any of them is matched, could be single string or list.
+	Match   StringList
+	Actions ActionList
+	// run actions of next case without checking after running this case
+	Fallthrough bool
+}
+
+func (c *SwitchCases) UnmarshalJSON(bytes []byte) error {
+	var arrayTester []json.RawMessage
+	if json.Unmarshal(bytes, &arrayTester) == nil {
+		return json.Unmarshal(bytes, &c.cases)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(bytes)))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("switch cases should be mapping or list")
+	}
+	c.cases = c.cases[:0]
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		var actions ActionList
+		err = dec.Decode(&actions)
+		if err != nil {
+			return err
+		}
+		c.cases = append(c.cases, SwitchCase{
+			Match:   StringList{tok.(string)},
+			Actions: actions,
+		})
+	}
+	_, err = dec.Token()
+	return err
+}
+func (c *SwitchCases) Length() int {
+	return len(c.cases)
+}
+func (c *SwitchCases) Cases() []SwitchCase {
+	return c.cases
 }
 
 // sugar for condition checking
 type ActionIf struct {
+	// boolean expression, same as Action.On
 	Check string
 
 	Actions ActionList
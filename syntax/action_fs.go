@@ -16,6 +16,16 @@ type fsActions struct {
 	Watch ActionWatch
 	// write content to file
 	Echo ActionEcho
+	// render file by go text/template
+	Render ActionRender
+	// create tar, tar.gz or zip archive
+	Archive ActionArchive
+	// extract tar, tar.gz, tar.bz2 or zip archive
+	Extract ActionExtract
+	// move or rename file/directory, support glob
+	Move ActionMove
+	// create symbolic link or hard link, support glob
+	Link ActionLink
 }
 
 const (
@@ -28,10 +38,36 @@ const (
 type ActionCopy struct {
 	// source url could be file or http/https if contains schema, otherwise it will be treated as file
 	// both source and dest could be directory in file mode.
-	// doesn't support glob
+	// local source could be text block of glob patterns, matched paths are copied into DestPath directory,
+	// keeping paths relative to the static prefix of pattern, such as 'assets/**/*.png; README.md'.
+	// patterns support '*', '**', '?' and '[...]', existing path is copied literally even if it contains them.
 	SourceUrl string
 	// if source is directory, destPath will be removed first, than copy again
 	DestPath string
+	// excluded paths, relative to source directory or static prefix of glob pattern,
+	// '**' matches zero or more directories, pattern without '/' matches base name, such as '*.tmp', 'test/**'.
+	Exclude []string
+	// included files, all files are included if empty, same format as Exclude.
+	Include []string
+	// copy symbolic links as links instead of their targets.
+	PreserveSymlinks bool
+	// ignore special files such as devices, named pipes and sockets, otherwise copying fails.
+	IgnoreSpecialFiles bool
+	// sync changed files instead of removing DestPath and copying again,
+	// files are unchanged if they have same size and modification time.
+	Sync bool
+	// compare file content instead of size and modification time in sync mode.
+	Checksum bool
+	// remove extraneous paths in DestPath in sync mode, paths filtered by Exclude and Include are kept.
+	Delete bool
+	// extract source archive into DestPath directory, format is detected by extension of source url,
+	// hash is checked for the archive. Include and StripComponents are applied to archive entries.
+	// existing DestPath is reused for remote resource unless Force is set.
+	Extract bool
+	// same as ActionExtract.StripComponents
+	StripComponents int
+	// files are written to temporary files and renamed to dest, set it to write in place and keep inodes.
+	InPlace bool
 	// Force
 	Force string
 	// hash checking for file
@@ -54,6 +90,8 @@ type ActionReplace struct {
 	Replaces []string
 	// do regexp replacing
 	Regexp bool
+	// file is written to temporary file and renamed, set it to write in place and keep inode.
+	InPlace bool
 }
 
 // change path mode such as 0644 for file, 0755 for directory and executable.
@@ -70,7 +108,81 @@ type ActionMkdir = string
 type ActionEcho struct {
 	Content string
 	File    string
-	Append  bool
+	// append is always written in place
+	Append bool
+	// file is written to temporary file and renamed, set it to write in place and keep inode.
+	InPlace bool
+}
+
+// render file by go text/template, template data is the task environment, list value is slice of string.
+// expand filters are available as functions with '.' replaced by '_', piped value is the last argument,
+// such as '{{ .VERSION | string_transform "upper" }}', missing env is reported as error.
+// user defined filters named as template builtin functions such as 'len' and 'index' aren't available.
+type ActionRender struct {
+	// template file path
+	Template string
+	// output file path
+	Dest string
+	// left and right delimiters, '{{' and '}}' by default
+	Delims []string
+	// output file mode, 0644 by default. dest is written to temporary file and renamed.
+	Mode uint
+}
+
+// create reproducible archive: entries are sorted, owners are dropped and timestamps are set to
+// SOURCE_DATE_EPOCH env if defined, otherwise 1980-01-01 00:00:00 UTC.
+type ActionArchive struct {
+	// tar, tar.gz(tgz) or zip, detected by Dest extension if empty
+	Format string
+	// source paths, support glob, directories are archived recursively and symlinks are kept.
+	// entry names are paths relative to working directory.
+	Src string
+	// archive file path
+	Dest string
+	// directory prefix of entry names, such as 'app-1.0'
+	Prefix string
+	// excluded entries, same format as ActionCopy.Exclude, matched with entry names without prefix.
+	Exclude []string
+}
+
+// extract archive into directory, modes, modification times and symlinks are kept, existing files are overwritten.
+// entries with absolute path, path or symlink target outside of dest directory are rejected.
+type ActionExtract struct {
+	// tar, tar.gz(tgz), tar.bz2(tbz2) or zip, detected by Src extension if empty
+	Format string
+	// archive file path
+	Src string
+	// dest directory
+	Dest string
+	// number of leading path components removed from entry names, such as 1 for 'go/bin/go'
+	StripComponents int
+	// extracted files, all entries are extracted if empty, same format as ActionCopy.Exclude,
+	// matched with entry names after stripping.
+	Include []string
+}
+
+// move or rename file/directory, falls back to copying and deleting across devices.
+// if Src matches multiple paths or Dest is existing directory, paths are moved into Dest directory.
+type ActionMove struct {
+	// support glob
+	Src  string
+	Dest string
+	// replace existing dest, otherwise moving fails
+	Overwrite bool
+}
+
+// create link, if Target matches multiple paths or Path is existing directory, links are created in Path directory.
+type ActionLink struct {
+	// link target, support glob, relative path is based on working directory, not link directory.
+	Target string
+	// link path
+	Path string
+	// create symbolic link instead of hard link
+	Symbolic bool
+	// symbolic link stores target path relative to link directory instead of absolute path
+	Relative bool
+	// replace existing file or link
+	Force bool
 }
 
 // watch fs changes
@@ -9,4 +9,6 @@ const (
 
 	// override by every AcionCommand, empty means command failed to start
 	BUILTIN_ENV_LAST_COMMAND_PID = "LAST_COMMAND_PID"
+	// regexp capture groups of matched switch case: MATCH_0, MATCH_1...
+	BUILTIN_ENV_MATCH_PREFIX = "MATCH_"
 )
@@ -2,6 +2,7 @@ package syntax
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // Env:
@@ -42,6 +43,32 @@ func (e *EnvList) AppendItem(s string) {
 	e.envs = append(e.envs, s)
 }
 
+// StringList: single string or list of strings
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(bytes []byte) error {
+	var s string
+	if json.Unmarshal(bytes, &s) == nil {
+		*l = []string{s}
+		return nil
+	}
+	return json.Unmarshal(bytes, (*[]string)(l))
+}
+
+// Position: source position in config file
+type Position struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p Position) String() string {
+	if p.Line <= 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
 type ActionList struct {
 	actions []Action
 }
@@ -71,11 +98,38 @@ func (a *ActionList) Length() int {
 func (a *ActionList) Actions() []Action {
 	return a.actions
 }
+func (a *ActionList) Pos() Position {
+	if len(a.actions) == 0 {
+		return Position{}
+	}
+	return a.actions[0].Pos
+}
+
+// ExpandFilter: user defined expand filter,
+//   could be a string as the Pipeline field.
+type ExpandFilter struct {
+	// compose existing filters, same syntax as filters in expanding: 'filter [arg]... | filter [arg]...'.
+	// filter args are accessible as $1, $2... in pipeline.
+	Pipeline string
+	// command line string, value is passed by stdin and filter args are appended to command argv,
+	// trimmed stdout is the filter result. it's run in task working directory.
+	Cmd string
+}
+
+func (f *ExpandFilter) UnmarshalJSON(bytes []byte) error {
+	var pipeline string
+	if json.Unmarshal(bytes, &pipeline) == nil {
+		f.Pipeline = pipeline
+		return nil
+	}
+	type expandFilter ExpandFilter
+	return json.Unmarshal(bytes, (*expandFilter)(f))
+}
 
 type Configuration struct {
 	// import other config files, supports path globbing, can be both absolute or relative path.
 	// relative path is based on current file directory.
-	// supports import tash config file(.yaml,.yml) and environment config file(.env)
+	// supports import tash config file(.yaml,.yml,.json,.toml) and environment config file(.env)
 	//
 	// directories will be ignored
 	Imports string
@@ -89,6 +143,10 @@ type Configuration struct {
 	// defines tasks
 	// the key is task name
 	Tasks map[string]Task
+
+	// defines expand filters, resolved after builtin filters and couldn't override them.
+	// the key is filter name
+	Filters map[string]ExpandFilter
 }
 
 // defines task arguments
@@ -101,18 +159,31 @@ type TaskArgument struct {
 }
 
 type Task struct {
+	// source position, filled by config decoder
+	Pos Position `json:"$pos"`
+
 	Description string
 	// current directory if empty
 	WorkDir string
 
 	// task arguments(can be passed as environment or command line options)
 	Args []TaskArgument
+	// start from clean environments instead of all system environments
+	CleanEnv bool
+	// system environments kept if CleanEnv is set, such as PATH and HOME
+	InheritEnv []string
 
 	// a sequence of task actions.
 	Actions ActionList
 }
 
 type Action struct {
+	// source position, filled by config decoder
+	Pos Position `json:"$pos"`
+
+	// boolean expression to run action, such as '$HOST_OS == linux && (-f go.mod || -d vendor)'.
+	// supports '&&', '||', '!', parentheses and operators, operands are expanded after parsing,
+	// single operand is checked as boolean value, operand contains spaces or parentheses should be quoted.
 	On string
 	contextActions
 	flowActions
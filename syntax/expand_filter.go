@@ -25,10 +25,27 @@ const (
 	Ef_string_index = "string.index"
 	// args: searching, search string
 	Ef_string_lastIndex = "string.lastIndex"
+	// printf-style formatting, input is the first operand, operands are converted by verbs, such as %d, %x and %f.
+	// args: 1: format, 2: format, extra operands...
+	Ef_string_format = "string.format"
+	// pad string to width, args: 1: left or right, 2: width, 3: pad character, default is ' '
+	Ef_string_pad = "string.pad"
+	// args: 1: count, 2: count, join separator
+	Ef_string_repeat = "string.repeat"
+	// split string to list, args: 1: separator
+	Ef_string_split = "string.split"
+	// return matched string or capture group, empty if not matched, args: 1: regexp, 2: regexp, group index
+	Ef_string_match = "string.match"
+	// return lines matches regexp, args: 1: regexp
+	Ef_lines_grep = "lines.grep"
 
 	// number calculating
 	// args: operator operand
 	Ef_number_calc = "number.calc"
+	// evaluate arithmetic expression: integers and floats, variables, + - * / % and parentheses,
+	// functions: min, max, round, ceil, floor, abs. division and modulo of integers keep integer result.
+	// args: no args
+	Ef_math_eval = "math.eval"
 
 	// args: ok [no]
 	Ef_condition_select       = "condition.select"
@@ -37,6 +54,7 @@ const (
 	Ef_condition_check       = "condition.check"
 	Ef_condition_check_alias = "?"
 
+	// array filters accept list or string, string is split by separator, and the result has the same type as input.
 	// sort strings, args: 0: split/join separator is ' ', 1: split/join separator is args[0]
 	Ef_array_sort = "array.sort"
 	// sort strings as number, args: same as array.sort
@@ -54,6 +72,15 @@ const (
 	Ef_array_index = "array.index"
 	// args: 1: element
 	Ef_array_has = "array.has"
+	// join array elements, args: 1: join separator
+	Ef_array_join = "array.join"
+	// remove duplicated elements, keep the first one, args: same as array.sort
+	Ef_array_unique = "array.unique"
+	// apply filters to each element, '|' in pipeline should be escaped as '\|' in expanding,
+	// args: 1: filter pipeline, 2: filter pipeline, array separator
+	Ef_array_map = "array.map"
+	// return element count, args: same as array.sort
+	Ef_array_len = "array.len"
 
 	// split string, calculate array slice and join
 	// args: 1: index
@@ -63,6 +90,21 @@ const (
 	// reset array separator, args: 1: new separator, 2: old new
 	Ef_array_separator = "array.separator"
 
+	// semantic version filters, leading 'v' is allowed, minor and patch could be omitted.
+	// bump version, pre-release version is bumped to it's release version if possible, build metadata is dropped.
+	// args: 1: major, minor or patch
+	Ef_semver_bump = "semver.bump"
+	// args: no args
+	Ef_semver_major = "semver.major"
+	// args: no args
+	Ef_semver_minor = "semver.minor"
+	// args: no args
+	Ef_semver_patch = "semver.patch"
+	// return dot separated pre-release identifiers, args: no args
+	Ef_semver_prerelease = "semver.prerelease"
+	// sort versions by SemVer 2.0 precedence, args: same as array.sort
+	Ef_semver_sort = "semver.sort"
+
 	// split string and return element by key, args: 1: key, 2: key, array separator
 	Ef_map_get = "map.get"
 	// split string and return keys, args: 0: no args, 1: array separator
@@ -72,8 +114,20 @@ const (
 
 	// get content from json, args: key, nested by '.'
 	Ef_json_get = "json.get"
+	// set json value, args: 1: key, 2: value as string, 3: key, value, 'json' to set raw json value
+	Ef_json_set = "json.set"
+	// delete json value, args: key
+	Ef_json_delete = "json.delete"
+	// return list of object keys or array indexes, args: 0: root value, 1: key
+	Ef_json_keys = "json.keys"
+	// get content from yaml, args: same as json.get
+	Ef_yaml_get = "yaml.get"
+	// get content from toml, args: same as json.get
+	Ef_toml_get = "toml.get"
+	// get content from ini, keys before first section are at top level, args: same as json.get, such as 'section.key'
+	Ef_ini_get = "ini.get"
 
-	// return files match given pattern, args: 0: join separator is ' ', 1: join separator is args[0]
+	// return files match given pattern, args: 0: return list, 1: join separator
 	Ef_file_glob = "file.glob"
 	// args: no args
 	Ef_file_abspath = "file.abspath"
@@ -90,6 +144,47 @@ const (
 	Ef_file_fromSlash = "file.fromSlash"
 	// args: no args
 	Ef_file_content = "file.content"
+	// relative path to base directory, args: 1: base directory
+	Ef_file_rel = "file.rel"
+	// join path elements, args: path elements...
+	Ef_file_join = "file.join"
+	// file size in bytes, args: no args
+	Ef_file_size = "file.size"
+	// file modification time, args: 0: output as timestamp, 1: output as format
+	Ef_file_mtime = "file.mtime"
+	// file permission bits in octal such as 0644, args: no args
+	Ef_file_mode = "file.mode"
+	// line count of file content, args: no args
+	Ef_file_lines = "file.lines"
+	// symbolic link target, args: no args
+	Ef_file_readlink = "file.readlink"
+	// search executable binary in PATH, empty if not found, args: no args
+	Ef_file_which = "file.which"
+
+	// hash file content, output hexadecimal string
+	// args: 1: hash algorithm, md5, sha1 or sha256, case insensitive
+	Ef_file_hash = "file.hash"
+	// hash directory tree deterministically: sorted relative paths and file contents, could be used as cache key
+	// args: 1: hash algorithm, same as file.hash
+	Ef_dir_hash = "dir.hash"
+
+	// hash string, output hexadecimal string, args: no args
+	Ef_hash_md5    = "hash.md5"
+	Ef_hash_sha1   = "hash.sha1"
+	Ef_hash_sha256 = "hash.sha256"
+
+	// args: no args
+	Ef_base64_encode = "base64.encode"
+	// args: no args
+	Ef_base64_decode = "base64.decode"
+	// args: no args
+	Ef_hex_encode = "hex.encode"
+	// args: no args
+	Ef_hex_decode = "hex.decode"
+	// url escaping, args: 0: query component escaping, 1: 'path' for path segment escaping
+	Ef_url_encode = "url.encode"
+	// url unescaping, args: same as url.encode
+	Ef_url_decode = "url.decode"
 
 	// args: 0: output as timestamp, 1: output as format, input will be ignored
 	Ef_date_now = "date.now"
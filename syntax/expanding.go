@@ -11,7 +11,12 @@ package syntax
 //	* $ENV_NAME_ALPHA_NUM
 //	* ${ENV_NAME_NO_LIMIT [| filter[ arg]...]...}
 //	* ${"string literal" [| filter[ arg]...]...}
+// filters are searched in builtin filters first, then user defined filters in configuration.
+// env value could be string or list, such as result of file.glob and string.split,
+// list is kept if the whole string is a single variable, it's joined by ' ' when interpolated into string,
+// or passed as separate arguments if it's an unquoted word of command.
 // uses '\' to avoid escaping, such as '\$', '\$', '\\'
+// '|' in filter args, such as pipeline of array.map or alternation of regexp, should be escaped as '\|'
 //
 // predefined task-specific env:
 //    WORKDIR: task initial working directory
@@ -22,6 +27,6 @@ package syntax
 // all path separator '\' on windows have been transformed to slash
 // to avoid conflicting with escaping in internal file paths
 //
-// Imports, Task name, Template name, Env value, File path in Del,Mkdir,Chmod, Replace,Watch
+// Imports, Task name, Template name, Env value, File path in Del,Mkdir,Chmod, Replace,Watch, local Copy source
 // can all be text block: lines of semicolon separated string
 // file path supports zglob, env value should be key=value or key="value"
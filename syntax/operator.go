@@ -3,41 +3,63 @@ package syntax
 // operators in condition and switch
 // there is a sugar that put a Op_bool_not before actual operator to do not checking.
 const (
-	Op_bool_not                  = "bool.not"
-	Op_bool_true                 = "bool.true"
-	Op_bool_and                  = "bool.and"
-	Op_bool_or                   = "bool.or"
-	Op_string_greaterThan        = "string.greaterThan"
-	Op_string_greaterThanOrEqual = "string.greaterThanOrEqual"
-	Op_string_equal              = "string.equal"
-	Op_string_notEqual           = "string.notEqual"
-	Op_string_lessThanOrEqual    = "string.lessThanOrEqual"
-	Op_string_lessThan           = "string.lessThan"
-	Op_string_notEmpty           = "string.notEmpty"
-	Op_string_empty              = "string.empty"
-	Op_string_regexp             = "string.regexp"
-	Op_number_greaterThan        = "number.greaterThan"
-	Op_number_greaterThanOrEqual = "number.greaterThanOrEqual"
-	Op_number_equal              = "number.equal"
-	Op_number_notEqual           = "number.notEqual"
-	Op_number_lessThanOrEqual    = "number.lessThanOrEqual"
-	Op_number_lessThan           = "number.lessThan"
-	Op_env_defined               = "env.defined"
-	Op_file_newerThan            = "file.newerThan"
-	Op_file_olderThan            = "file.olderThan"
-	Op_file_exist                = "file.exist"
-	Op_file_blockDevice          = "file.blockDevice"
-	Op_file_charDevice           = "file.charDevice"
-	Op_file_dir                  = "file.dir"
-	Op_file_regular              = "file.regular"
-	Op_file_setgid               = "file.setgid"
-	Op_file_symlink              = "file.symlink"
-	Op_file_sticky               = "file.sticky"
-	Op_file_namedPipe            = "file.namedPipe"
-	Op_file_notEmpty             = "file.notEmpty"
-	Op_file_socket               = "file.socket"
-	Op_file_setuid               = "file.setuid"
-	Op_file_binary               = "file.binary"
+	Op_bool_not                   = "bool.not"
+	Op_bool_true                  = "bool.true"
+	Op_bool_and                   = "bool.and"
+	Op_bool_or                    = "bool.or"
+	Op_string_greaterThan         = "string.greaterThan"
+	Op_string_greaterThanOrEqual  = "string.greaterThanOrEqual"
+	Op_string_equal               = "string.equal"
+	Op_string_notEqual            = "string.notEqual"
+	Op_string_lessThanOrEqual     = "string.lessThanOrEqual"
+	Op_string_lessThan            = "string.lessThan"
+	Op_string_notEmpty            = "string.notEmpty"
+	Op_string_empty               = "string.empty"
+	Op_string_regexp              = "string.regexp"
+	Op_string_glob                = "string.glob" // compare field: glob pattern, '*' and '?' don't match '/'
+	Op_number_greaterThan         = "number.greaterThan"
+	Op_number_greaterThanOrEqual  = "number.greaterThanOrEqual"
+	Op_number_equal               = "number.equal"
+	Op_number_notEqual            = "number.notEqual"
+	Op_number_lessThanOrEqual     = "number.lessThanOrEqual"
+	Op_number_lessThan            = "number.lessThan"
+	Op_version_greaterThan        = "version.greaterThan"
+	Op_version_greaterThanOrEqual = "version.greaterThanOrEqual"
+	Op_version_equal              = "version.equal"
+	Op_version_notEqual           = "version.notEqual"
+	Op_version_lessThanOrEqual    = "version.lessThanOrEqual"
+	Op_version_lessThan           = "version.lessThan"
+	Op_env_defined                = "env.defined"
+	Op_file_newerThan             = "file.newerThan"
+	Op_file_olderThan             = "file.olderThan"
+	Op_file_exist                 = "file.exist"
+	Op_file_blockDevice           = "file.blockDevice"
+	Op_file_charDevice            = "file.charDevice"
+	Op_file_dir                   = "file.dir"
+	Op_file_regular               = "file.regular"
+	Op_file_setgid                = "file.setgid"
+	Op_file_symlink               = "file.symlink"
+	Op_file_sticky                = "file.sticky"
+	Op_file_namedPipe             = "file.namedPipe"
+	Op_file_notEmpty              = "file.notEmpty"
+	Op_file_socket                = "file.socket"
+	Op_file_setuid                = "file.setuid"
+	Op_file_binary                = "file.binary"
+	Op_file_readable              = "file.readable"
+	Op_file_writable              = "file.writable"
+	Op_file_executable            = "file.executable"
+	Op_file_ownedByUser           = "file.ownedByUser"
+	Op_file_ownedByGroup          = "file.ownedByGroup"
+	Op_file_modifiedSinceRead     = "file.modifiedSinceRead"
+	Op_fd_terminal                = "fd.terminal"
+	Op_file_contains              = "file.contains"
+	Op_file_matches               = "file.matches" // POSIX regexp, '^' and '$' match at line boundaries
+	Op_file_sameContent           = "file.sameContent"
+	Op_file_hashEqual             = "file.hashEqual" // compare field: ALG:SIG, such as sha256:e3b0c442...
+	// network checking is a single attempt with short timeout
+	Op_net_portOpen = "net.portOpen" // value: HOST:PORT
+	Op_net_portFree = "net.portFree" // value: PORT or HOST:PORT
+	Op_http_status  = "http.status"  // value: URL, compare field: status code such as 200 or 2xx, redirects are not followed
 )
 
 var OperatorAlias = map[string]string{
@@ -61,6 +83,12 @@ var OperatorAlias = map[string]string{
 	"-ne":  Op_number_notEqual,
 	"-le":  Op_number_lessThanOrEqual,
 	"-lt":  Op_number_lessThan,
+	"-vgt": Op_version_greaterThan,
+	"-vge": Op_version_greaterThanOrEqual,
+	"-veq": Op_version_equal,
+	"-vne": Op_version_notEqual,
+	"-vle": Op_version_lessThanOrEqual,
+	"-vlt": Op_version_lessThan,
 	"-env": Op_env_defined,
 	"-nt":  Op_file_newerThan,
 	"-ot":  Op_file_olderThan,
@@ -79,6 +107,49 @@ var OperatorAlias = map[string]string{
 	"-S":   Op_file_socket,
 	"-u":   Op_file_setuid,
 	"-B":   Op_file_binary,
+	"-r":   Op_file_readable,
+	"-w":   Op_file_writable,
+	"-x":   Op_file_executable,
+	"-O":   Op_file_ownedByUser,
+	"-G":   Op_file_ownedByGroup,
+	"-N":   Op_file_modifiedSinceRead,
+	"-t":   Op_fd_terminal,
+}
+
+// IsUnaryOP reports whether operator checks single value without compare field, aliases should be resolved first.
+func IsUnaryOP(op string) bool {
+	switch op {
+	case Op_bool_not,
+		Op_bool_true,
+		Op_string_notEmpty,
+		Op_string_empty,
+		Op_env_defined,
+		Op_file_exist,
+		Op_file_blockDevice,
+		Op_file_charDevice,
+		Op_file_dir,
+		Op_file_regular,
+		Op_file_setgid,
+		Op_file_symlink,
+		Op_file_sticky,
+		Op_file_namedPipe,
+		Op_file_notEmpty,
+		Op_file_socket,
+		Op_file_setuid,
+		Op_file_binary,
+		Op_file_readable,
+		Op_file_writable,
+		Op_file_executable,
+		Op_file_ownedByUser,
+		Op_file_ownedByGroup,
+		Op_file_modifiedSinceRead,
+		Op_fd_terminal,
+		Op_net_portOpen,
+		Op_net_portFree:
+		return true
+	default:
+		return false
+	}
 }
 
 func IsValidOP(op string) bool {
@@ -96,12 +167,19 @@ func IsValidOP(op string) bool {
 		Op_string_notEmpty,
 		Op_string_empty,
 		Op_string_regexp,
+		Op_string_glob,
 		Op_number_greaterThan,
 		Op_number_greaterThanOrEqual,
 		Op_number_equal,
 		Op_number_notEqual,
 		Op_number_lessThanOrEqual,
 		Op_number_lessThan,
+		Op_version_greaterThan,
+		Op_version_greaterThanOrEqual,
+		Op_version_equal,
+		Op_version_notEqual,
+		Op_version_lessThanOrEqual,
+		Op_version_lessThan,
 		Op_env_defined,
 		Op_file_newerThan,
 		Op_file_olderThan,
@@ -117,7 +195,21 @@ func IsValidOP(op string) bool {
 		Op_file_notEmpty,
 		Op_file_socket,
 		Op_file_setuid,
-		Op_file_binary:
+		Op_file_binary,
+		Op_file_readable,
+		Op_file_writable,
+		Op_file_executable,
+		Op_file_ownedByUser,
+		Op_file_ownedByGroup,
+		Op_file_modifiedSinceRead,
+		Op_fd_terminal,
+		Op_file_contains,
+		Op_file_matches,
+		Op_file_sameContent,
+		Op_file_hashEqual,
+		Op_net_portOpen,
+		Op_net_portFree,
+		Op_http_status:
 		return true
 	default:
 		_, has := OperatorAlias[op]
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -21,7 +22,7 @@ import (
 	"strings"
 
 	"github.com/cosiner/argv"
-	"github.com/mattn/go-zglob"
+	"github.com/mattn/go-isatty"
 	"github.com/uiez/tash/syntax"
 )
 
@@ -71,107 +72,152 @@ func stringSplitAndTrimToPair(s, sep string) (s1, s2 string) {
 	return stringAtAndTrim(secs, 0), stringAtAndTrim(secs, 1)
 }
 
-func copyFile(dst, src string) error {
-	srcFd, err := os.OpenFile(src, os.O_RDONLY, 0)
-	if err != nil {
-		return err
+// newHasher creates hasher by algorithm name, case insensitive
+func newHasher(alg string) (hash.Hash, error) {
+	switch strings.ToUpper(alg) {
+	case syntax.ResourceHashAlgSha1:
+		return sha1.New(), nil
+	case syntax.ResourceHashAlgMD5:
+		return md5.New(), nil
+	case syntax.ResourceHashAlgSha256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", alg)
 	}
-	srcStat, err := srcFd.Stat()
+}
+
+func checkHash(log logger, path string, alg, sig string, r io.Reader) bool {
+	ok, err := matchHash(alg, sig, r)
 	if err != nil {
-		return err
+		log.fatalln("check hash failed:", path, err)
+		return false
+	}
+	return ok
+}
+
+// matchHash checks whether hash of content equals to hexadecimal signature.
+func matchHash(alg, sig string, r io.Reader) (bool, error) {
+	h, err := newHasher(alg)
+	if err != nil || sig == "" {
+		return false, fmt.Errorf("invalid hash alg or sig: %s:%s", alg, sig)
 	}
-	defer srcFd.Close()
-	dstFd, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	_, err = io.Copy(h, r)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer dstFd.Close()
-	_, err = io.Copy(dstFd, srcFd)
-	if err == nil {
-		err = os.Chmod(dst, srcStat.Mode())
+	return hex.EncodeToString(h.Sum(nil)) == strings.ToLower(sig), nil
+}
+
+// sameFileContent compares content of two files, false if any of them doesn't exist.
+func sameFileContent(path1, path2 string) (bool, error) {
+	s1, e1 := os.Stat(path1)
+	s2, e2 := os.Stat(path2)
+	if os.IsNotExist(e1) || os.IsNotExist(e2) {
+		return false, nil
 	}
+	if e1 != nil || e2 != nil {
+		return false, fmt.Errorf("access files failed: %s %s", e1, e2)
+	}
+	if s1.IsDir() || s2.IsDir() {
+		return false, fmt.Errorf("can't compare content of directory: %s %s", path1, path2)
+	}
+	if s1.Size() != s2.Size() {
+		return false, nil
+	}
+	fd1, err := os.Open(path1)
 	if err != nil {
-		os.Remove(dst)
-		return err
+		return false, err
+	}
+	defer fd1.Close()
+	fd2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer fd2.Close()
+
+	const bufSize = 32 * 1024
+	b1 := make([]byte, bufSize)
+	b2 := make([]byte, bufSize)
+	for {
+		n1, e1 := io.ReadFull(fd1, b1)
+		n2, e2 := io.ReadFull(fd2, b2)
+		if !bytes.Equal(b1[:n1], b2[:n2]) {
+			return false, nil
+		}
+		eof1 := e1 == io.EOF || e1 == io.ErrUnexpectedEOF
+		eof2 := e2 == io.EOF || e2 == io.ErrUnexpectedEOF
+		if eof1 || eof2 {
+			return eof1 && eof2, nil
+		}
+		if e1 != nil {
+			return false, e1
+		}
+		if e2 != nil {
+			return false, e2
+		}
 	}
-	return nil
 }
 
-func copyPath(dst, src string) error {
-	stat, err := os.Stat(src)
+func hashFile(alg, path string) (string, error) {
+	h, err := newHasher(alg)
 	if err != nil {
-		return fmt.Errorf("read source path status failed: %w", err)
+		return "", err
 	}
-	err = os.RemoveAll(dst)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("remove dst path failed: %w", err)
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
-	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	defer fd.Close()
+	_, err = io.Copy(h, fd)
 	if err != nil {
-		return fmt.Errorf("create dst path dirs failed: %w", err)
+		return "", err
 	}
-	if !stat.IsDir() {
-		err = os.MkdirAll(filepath.Dir(dst), 0755)
-		if err != nil {
-			return fmt.Errorf("create dst parent directory tree failed: %w", err)
-		}
-		return copyFile(dst, src)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir hashes directory tree deterministically, paths are walked in lexical order,
+// and both slash relative paths and contents of files are hashed.
+func hashDir(alg, dir string) (string, error) {
+	h, err := newHasher(alg)
+	if err != nil {
+		return "", err
 	}
-	dirChmods := map[string]os.FileMode{}
-	err = filepath.Walk(src, func(srcPath string, info os.FileInfo, err error) error {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		relPath, err := filepath.Rel(src, srcPath)
+		relpath, err := filepath.Rel(dir, path)
 		if err != nil {
 			return err
 		}
-		dstPath := filepath.Join(dst, relPath)
-		if info.IsDir() {
-			err = os.Mkdir(dstPath, 0755)
+		relpath = stringToSlash(relpath)
+		switch {
+		case info.IsDir():
+			_, _ = io.WriteString(h, "d "+relpath+"\x00")
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
 			if err != nil {
 				return err
 			}
-			if info.Mode() != 0755 {
-				dirChmods[dstPath] = info.Mode()
+			_, _ = io.WriteString(h, "l "+relpath+"\x00"+stringToSlash(target)+"\x00")
+		case info.Mode().IsRegular():
+			_, _ = io.WriteString(h, "f "+relpath+"\x00"+strconv.FormatInt(info.Size(), 10)+"\x00")
+			fd, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, fd)
+			fd.Close()
+			if err != nil {
+				return err
 			}
-			return nil
 		}
-		return copyFile(dstPath, srcPath)
+		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("copy path tree failed: %w", err)
-	}
-	for dir, mode := range dirChmods {
-		err = os.Chmod(dir, mode)
-		if err != nil {
-			return fmt.Errorf("fix dir mod failed: %w", err)
-		}
+		return "", err
 	}
-	return nil
-}
-
-func checkHash(log logger, path string, alg, sig string, r io.Reader) bool {
-	var hashCreator func() hash.Hash
-	switch alg {
-	case syntax.ResourceHashAlgSha1:
-		hashCreator = sha1.New
-	case syntax.ResourceHashAlgMD5:
-		hashCreator = md5.New
-	case syntax.ResourceHashAlgSha256:
-		hashCreator = sha256.New
-	}
-	if hashCreator == nil || sig == "" {
-		log.fatalln("invalid hash alg or sig:", path)
-		return false
-	}
-	h := hashCreator()
-	_, err := io.Copy(h, r)
-	if err != nil {
-		log.fatalln("check hash failed:", path, err)
-		return false
-	}
-	return hex.EncodeToString(h.Sum(nil)) == strings.ToLower(sig)
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func downloadFile(url string) (string, error) {
@@ -219,7 +265,6 @@ func execCommand(envs *ExpandEnvs, sections [][]string, cmdDir string, needsOutp
 		}
 	}
 	if needsOutput {
-		fds.Stdin = nil
 		fds.Stdout = bytes.NewBuffer(nil)
 		fds.Stderr = nil
 	}
@@ -240,7 +285,7 @@ func execCommand(envs *ExpandEnvs, sections [][]string, cmdDir string, needsOutp
 	return pid, "", nil
 }
 
-func runCommand(envs *ExpandEnvs, cmd, cmdDir string, needsOutput bool, fds commandFds, background bool) (pid int, output string, err error) {
+func parseCommand(envs *ExpandEnvs, cmd, cmdDir string) ([][]string, error) {
 	sections, err := argv.Argv(
 		cmd,
 		func(cmd string) (string, error) {
@@ -249,10 +294,18 @@ func runCommand(envs *ExpandEnvs, cmd, cmdDir string, needsOutput bool, fds comm
 		envs.expandString,
 	)
 	if err != nil {
-		return 0, "", fmt.Errorf("parse command string failed: %s", err)
+		return nil, fmt.Errorf("parse command string failed: %s", err)
 	}
 	if len(sections) == 0 {
-		return 0, "", fmt.Errorf("empty command line string")
+		return nil, fmt.Errorf("empty command line string")
+	}
+	return sections, nil
+}
+
+func runCommand(envs *ExpandEnvs, cmd, cmdDir string, needsOutput bool, fds commandFds, background bool) (pid int, output string, err error) {
+	sections, err := parseCommand(envs, cmd, cmdDir)
+	if err != nil {
+		return 0, "", err
 	}
 	return execCommand(envs, sections, cmdDir, needsOutput, fds, background)
 }
@@ -261,6 +314,20 @@ func getCmdStringOutput(envs *ExpandEnvs, cmd, cmdDir string) (string, error) {
 	_, output, err := runCommand(envs, cmd, cmdDir, true, commandFds{}, false)
 	return output, err
 }
+
+// getCmdFilterOutput runs command with input as stdin, args are appended to the first command argv.
+func getCmdFilterOutput(envs *ExpandEnvs, cmd string, args []string, input string) (string, error) {
+	// command is run in task working directory, which may be different from current directory in chdir block
+	workDir, _ := envs.get(syntax.BUILTIN_ENV_WORKDIR)
+	sections, err := parseCommand(envs, cmd, workDir)
+	if err != nil {
+		return "", err
+	}
+	sections[0] = append(sections[0], args...)
+	_, output, err := execCommand(envs, sections, workDir, true, commandFds{Stdin: strings.NewReader(input)}, false)
+	return output, err
+}
+
 func parseInt(s string) (int64, error) {
 	for prefix, base := range map[string]int{
 		"0x": 16,
@@ -268,11 +335,67 @@ func parseInt(s string) (int64, error) {
 		"0b": 2,
 	} {
 		if strings.HasPrefix(s, prefix) {
-			return strconv.ParseInt(s, base, 64)
+			return strconv.ParseInt(s[len(prefix):], base, 64)
 		}
 	}
 	return strconv.ParseInt(s, 10, 64)
 }
+
+// formatString formats operands by fmt verbs, operands are converted to integer for %d, %b, %o, %x, %X and %c,
+// to float for %e, %E, %f, %F, %g and %G.
+// '*' width or precision and explicit argument indexes aren't supported.
+func formatString(format string, operands []string) (string, error) {
+	var (
+		vals    []interface{}
+		operand int
+	)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			break
+		}
+		verb := format[i]
+		if verb == '%' {
+			continue
+		}
+		// operands couldn't be matched with verbs by order
+		if verb == '*' || verb == '[' {
+			return "", fmt.Errorf("unsupported width, precision or argument index: %%%c", verb)
+		}
+		if operand >= len(operands) {
+			return "", fmt.Errorf("missing operand for verb: %%%c", verb)
+		}
+		s := operands[operand]
+		operand++
+		switch verb {
+		case 'd', 'b', 'o', 'x', 'X', 'c':
+			n, err := parseInt(s)
+			if err != nil {
+				return "", fmt.Errorf("invalid integer for verb %%%c: %s", verb, s)
+			}
+			vals = append(vals, n)
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			n, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid float for verb %%%c: %s", verb, s)
+			}
+			vals = append(vals, n)
+		default:
+			vals = append(vals, s)
+		}
+	}
+	if operand < len(operands) {
+		return "", fmt.Errorf("too many operands for format: %s", format)
+	}
+	return fmt.Sprintf(format, vals...), nil
+}
+
 func parseBool(s string) (bool, error) {
 	switch strings.ToLower(s) {
 	case "true", "yes", "1":
@@ -311,6 +434,12 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 		}
 		ok = r.MatchString(value)
 
+	case syntax.Op_string_glob:
+		var err error
+		ok, err = path.Match(compare, value)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob pattern: %s, %s", compare, err)
+		}
 	case syntax.Op_string_greaterThan:
 		ok = value > compare
 	case syntax.Op_string_greaterThanOrEqual:
@@ -332,31 +461,59 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 		syntax.Op_number_lessThan:
 
 		var (
-			v1, v2     int64
+			v1, v2     number
 			err1, err2 error
 		)
 		if value != "" {
-			v1, err1 = parseInt(value)
+			v1, err1 = parseNumber(value)
 		}
 		if v := compare; v != "" {
-			v2, err2 = parseInt(v)
+			v2, err2 = parseNumber(v)
 		}
 		if err1 != nil || err2 != nil {
-			return false, fmt.Errorf("convert values to float number failed: %s, %s", value, compare)
+			return false, fmt.Errorf("convert values to number failed: %s, %s", value, compare)
 		}
+		c := compareNumber(v1, v2)
 		switch operator {
 		case syntax.Op_number_greaterThan:
-			ok = v1 > v2
+			ok = c > 0
 		case syntax.Op_number_greaterThanOrEqual:
-			ok = v1 >= v2
+			ok = c >= 0
 		case syntax.Op_number_equal:
-			ok = v1 == v2
+			ok = c == 0
 		case syntax.Op_number_notEqual:
-			ok = v1 != v2
+			ok = c != 0
 		case syntax.Op_number_lessThanOrEqual:
-			ok = v1 <= v2
+			ok = c <= 0
 		case syntax.Op_number_lessThan:
-			ok = v1 < v2
+			ok = c < 0
+		}
+	case syntax.Op_version_greaterThan,
+		syntax.Op_version_greaterThanOrEqual,
+		syntax.Op_version_equal,
+		syntax.Op_version_notEqual,
+		syntax.Op_version_lessThanOrEqual,
+		syntax.Op_version_lessThan:
+
+		v1, err1 := parseSemver(value)
+		v2, err2 := parseSemver(compare)
+		if err1 != nil || err2 != nil {
+			return false, fmt.Errorf("parse semantic versions failed: %s, %s", value, compare)
+		}
+		c := compareSemver(v1, v2)
+		switch operator {
+		case syntax.Op_version_greaterThan:
+			ok = c > 0
+		case syntax.Op_version_greaterThanOrEqual:
+			ok = c >= 0
+		case syntax.Op_version_equal:
+			ok = c == 0
+		case syntax.Op_version_notEqual:
+			ok = c != 0
+		case syntax.Op_version_lessThanOrEqual:
+			ok = c <= 0
+		case syntax.Op_version_lessThan:
+			ok = c < 0
 		}
 	case syntax.Op_file_newerThan, syntax.Op_file_olderThan:
 		s1, e1 := os.Stat(value)
@@ -370,6 +527,46 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 		case syntax.Op_file_olderThan:
 			ok = s1.ModTime().Before(s2.ModTime())
 		}
+	case syntax.Op_file_contains, syntax.Op_file_matches:
+		content, err := ioutil.ReadFile(value)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("read file failed: %s, %w", value, err)
+		}
+		if operator == syntax.Op_file_contains {
+			ok = bytes.Contains(content, []byte(compare))
+		} else {
+			r, err := regexp.CompilePOSIX(compare)
+			if err != nil {
+				return false, fmt.Errorf("compile regexp failed: %s, %s", compare, err)
+			}
+			ok = r.Match(content)
+		}
+	case syntax.Op_file_sameContent:
+		return sameFileContent(value, compare)
+	case syntax.Op_file_hashEqual:
+		secs := strings.SplitN(compare, ":", 2)
+		if len(secs) != 2 {
+			return false, fmt.Errorf("invalid hash signature, should be ALG:SIG: %s", compare)
+		}
+		// algorithm is validated even if file doesn't exist
+		_, err := newHasher(secs[0])
+		if err != nil {
+			return false, err
+		}
+		fd, err := os.Open(value)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("open file failed: %s, %w", value, err)
+		}
+		defer fd.Close()
+		return matchHash(secs[0], secs[1], fd)
+	case syntax.Op_http_status:
+		return checkHttpStatus(value, compare)
 	case syntax.Op_bool_and,
 		syntax.Op_bool_or:
 		o1, e1 := parseBool(value)
@@ -443,7 +640,12 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 			ok = checkFileStatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeSetgid != 0
 			})
-		//case "-G":
+		case syntax.Op_file_ownedByGroup:
+			stat, err := os.Stat(value)
+			if err != nil {
+				return false, nil
+			}
+			return checkFileOwnedByGroup(stat)
 		case syntax.Op_file_symlink:
 			ok = checkFileLstatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeSymlink != 0
@@ -452,14 +654,20 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 			ok = checkFileStatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeSticky != 0
 			})
-		//case "-N":
-		//case "-O":
+		case syntax.Op_file_modifiedSinceRead:
+			ok = checkFileStat(checkFileModifiedSinceRead)
+		case syntax.Op_file_ownedByUser:
+			stat, err := os.Stat(value)
+			if err != nil {
+				return false, nil
+			}
+			return checkFileOwnedByUser(stat)
 		case syntax.Op_file_namedPipe:
 			ok = checkFileStatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeNamedPipe != 0
 			})
-		//case "-r":
-
+		case syntax.Op_file_readable:
+			ok = checkFileAccess(value, accessRead)
 		case syntax.Op_file_notEmpty:
 			ok = checkFileStat(func(stat os.FileInfo) bool {
 				return stat.Size() > 0
@@ -468,22 +676,30 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 			ok = checkFileStatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeSocket != 0
 			})
-		//case "-t":
+		case syntax.Op_fd_terminal:
+			fd, err := parseInt(value)
+			if err != nil || fd < 0 {
+				return false, fmt.Errorf("invalid file descriptor: %s", value)
+			}
+			ok = isTerminal(uintptr(fd))
 		case syntax.Op_file_setuid:
 			ok = checkFileStatMode(func(mode os.FileMode) bool {
 				return mode&os.ModeSetuid != 0
 			})
-		//case "-w":
-		//case "-x":
+		case syntax.Op_file_writable:
+			ok = checkFileAccess(value, accessWrite)
+		case syntax.Op_file_executable:
+			ok = checkFileAccess(value, accessExecute)
 		case syntax.Op_file_binary:
-			_, err := exec.LookPath(value)
+			path, err := lookupExecutable(value)
 			if err != nil {
-				if errors.Is(err, exec.ErrNotFound) {
-					return false, nil
-				}
-				return false, fmt.Errorf("lookup executable binary failed: %w", err)
+				return false, err
 			}
-			return true, nil
+			return path != "", nil
+		case syntax.Op_net_portOpen:
+			return checkPortOpen(value)
+		case syntax.Op_net_portFree:
+			return checkPortFree(value)
 		default:
 			return false, fmt.Errorf("invalid condition operator: %s", operator)
 		}
@@ -491,7 +707,33 @@ func checkCondition(envs *ExpandEnvs, value, operator string, compareField *stri
 	return ok, nil
 }
 
-func fileReplacer(args []string, isRegexp bool) (func(path string) error, error) {
+// isTerminal checks whether file descriptor is a terminal, standard descriptors are mapped to handles on windows.
+func isTerminal(fd uintptr) bool {
+	switch fd {
+	case 0:
+		fd = os.Stdin.Fd()
+	case 1:
+		fd = os.Stdout.Fd()
+	case 2:
+		fd = os.Stderr.Fd()
+	}
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// lookupExecutable searches executable binary in PATH, empty if not found.
+func lookupExecutable(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("lookup executable binary failed: %w", err)
+	}
+	return path, nil
+}
+
+// fileReplacer replaces file content atomically unless inPlace is set.
+func fileReplacer(args []string, isRegexp, inPlace bool) (func(path string) error, error) {
 	if len(args) == 0 {
 		return func(path string) error {
 			return nil
@@ -499,6 +741,17 @@ func fileReplacer(args []string, isRegexp bool) (func(path string) error, error)
 	}
 	withFileContent := func(fn func([]byte) []byte) func(path string) error {
 		return func(path string) error {
+			if !inPlace {
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				content = fn(content)
+				return writeFileAtomic(path, 0, func(w io.Writer) error {
+					_, err := w.Write(content)
+					return err
+				})
+			}
 			fd, err := os.OpenFile(path, os.O_RDWR, 0)
 			if err != nil {
 				return err
@@ -553,6 +806,13 @@ func fileReplacer(args []string, isRegexp bool) (func(path string) error, error)
 	}), nil
 }
 
+// shellQuote quotes string by single quotes, it's kept as is in parsing command line.
+// backslashes are escaped because they are also unescaped in quotes by the command line parser.
+func shellQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
 func stringToSlash(s string) string {
 	return filepath.ToSlash(s)
 }
@@ -584,6 +844,49 @@ func openFile(name string, append bool) (*os.File, error) {
 	return os.OpenFile(name, flags, 00644)
 }
 
+// writeFileAtomic writes file by writing a temporary file in the same directory and renaming it to the path,
+// so readers never see partially written content. mode of existing file is kept if mode is 0,
+// symbolic link is resolved and its target is replaced.
+func writeFileAtomic(path string, mode os.FileMode, write func(w io.Writer) error) error {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if mode == 0 {
+		mode = 0644
+		if stat, err := os.Stat(path); err == nil {
+			mode = stat.Mode()
+		}
+	}
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("create parent directories failed: %w", err)
+	}
+	fd, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file failed: %w", err)
+	}
+	tmp := fd.Name()
+	err = write(fd)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
 func stringUnquote(s string) string {
 	l := len(s)
 	if l >= 2 {
@@ -620,7 +923,7 @@ func splitBlocksAndGlobPath(path string, mustBeFile bool) ([]string, error) {
 	var matched []string
 	blocks := splitBlocks(path)
 	for _, block := range blocks {
-		m, err := zglob.Glob(block)
+		m, err := globPath(block)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("glob path failed: %s, %w", block, err)
 		}
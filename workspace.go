@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-zglob"
+)
+
+// the separator between project path and task name, such as 'services/api:test'
+const projectTaskSeparator = ":"
+
+// project is a directory contains tash config file
+type project struct {
+	// slash path relative to workspace root directory, empty for root project
+	path    string
+	dir     string
+	configs *Configuration
+}
+
+func (p *project) taskAddress(name string) string {
+	if p.path == "" {
+		return name
+	}
+	return p.path + projectTaskSeparator + name
+}
+
+// workspace is the directory tree under root config file directory.
+type workspace struct {
+	log      indentLogger
+	root     *project
+	excludes []string
+
+	projects   map[string]*project
+	discovered []*project
+}
+
+func newWorkspace(log indentLogger, conf string, configs *Configuration, excludes []string) *workspace {
+	dir, err := filepath.Abs(filepath.Dir(conf))
+	if err != nil {
+		log.fatalln("get config file directory failed:", err)
+		return nil
+	}
+	root := &project{
+		dir:     dir,
+		configs: configs,
+	}
+	return &workspace{
+		log:      log,
+		root:     root,
+		excludes: excludes,
+		projects: map[string]*project{"": root},
+	}
+}
+
+// loadProject loads project under relative directory, nil if there is no config file.
+func (w *workspace) loadProject(relpath string) *project {
+	relpath = path.Clean(stringToSlash(relpath))
+	if relpath == "." {
+		relpath = ""
+	}
+	if p, has := w.projects[relpath]; has {
+		return p
+	}
+	dir := filepath.Join(w.root.dir, filepath.FromSlash(relpath))
+	conf := lookupConfigurationInDir(dir)
+	if conf == "" {
+		w.projects[relpath] = nil
+		return nil
+	}
+	w.log.debugln("load project config file:", conf)
+	p := &project{
+		path:    relpath,
+		dir:     dir,
+		configs: loadConfiguration(w.log.addIndent(), w.root.dir, conf),
+	}
+	w.projects[relpath] = p
+	return p
+}
+
+// resolveTask resolves task name or 'project:task' address.
+// a name is treated as address only if it isn't a root task and the prefix is a project directory.
+func (w *workspace) resolveTask(name string) (*project, string, bool) {
+	if _, has := w.root.configs.Tasks[name]; has {
+		return w.root, name, true
+	}
+	idx := strings.LastIndex(name, projectTaskSeparator)
+	if idx <= 0 {
+		return nil, "", false
+	}
+	p := w.loadProject(name[:idx])
+	if p == nil {
+		return nil, "", false
+	}
+	name = name[idx+1:]
+	_, has := p.configs.Tasks[name]
+	return p, name, has
+}
+
+// discover indexes all projects in workspace, directories ignored by .gitignore or excluded are skipped.
+func (w *workspace) discover() []*project {
+	if w.discovered != nil {
+		return w.discovered
+	}
+
+	var ignores []ignorePattern
+	err := filepath.Walk(w.root.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			w.log.warnln("walk directory failed:", p, err)
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		relpath, err := filepath.Rel(w.root.dir, p)
+		if err != nil {
+			return err
+		}
+		relpath = stringToSlash(relpath)
+		if relpath == "." {
+			relpath = ""
+		} else {
+			if info.Name() == ".git" || matchIgnorePatterns(ignores, relpath, true) {
+				w.log.debugln("skip ignored directory:", relpath)
+				return filepath.SkipDir
+			}
+			for _, e := range w.excludes {
+				if ok, _ := zglob.Match(e, relpath); ok {
+					w.log.debugln("skip excluded directory:", relpath)
+					return filepath.SkipDir
+				}
+			}
+		}
+		patterns, err := readIgnorePatterns(p, relpath)
+		if err != nil {
+			w.log.warnln("read .gitignore failed:", relpath, err)
+		}
+		ignores = append(ignores, patterns...)
+
+		if proj := w.loadProject(relpath); proj != nil {
+			w.discovered = append(w.discovered, proj)
+		}
+		return nil
+	})
+	if err != nil {
+		w.log.fatalln("discover projects failed:", err)
+		return nil
+	}
+	sort.Slice(w.discovered, func(i, j int) bool {
+		return w.discovered[i].path < w.discovered[j].path
+	})
+	return w.discovered
+}
+
+// ignorePattern is a line of .gitignore file
+type ignorePattern struct {
+	// slash directory of the .gitignore file relative to workspace root
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func readIgnorePatterns(dir, base string) ([]ignorePattern, error) {
+	fd, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fd.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.pattern = line
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+func (p ignorePattern) match(relpath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relpath, p.base+"/") {
+			return false
+		}
+		relpath = relpath[len(p.base)+1:]
+	}
+	if !p.anchored {
+		relpath = path.Base(relpath)
+	}
+	ok, _ := zglob.Match(p.pattern, relpath)
+	return ok
+}
+
+// matchIgnorePatterns reports whether path is ignored, the last matched pattern wins.
+func matchIgnorePatterns(patterns []ignorePattern, relpath string, isDir bool) bool {
+	var ignored bool
+	for _, p := range patterns {
+		if p.match(relpath, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (w *workspace) listTasks(log indentLogger, taskNames []string, showArgs bool, all bool) {
+	if !all {
+		listTasks(w.root.configs, log, taskNames, showArgs)
+		return
+	}
+	for _, p := range w.discover() {
+		if len(p.configs.Tasks) == 0 {
+			continue
+		}
+		var names []string
+		for _, name := range taskNames {
+			if _, has := p.configs.Tasks[name]; has {
+				names = append(names, name)
+			}
+		}
+		if len(taskNames) > 0 && len(names) == 0 {
+			continue
+		}
+		if p.path == "" {
+			log.infoln("project: .")
+		} else {
+			log.infoln(fmt.Sprintf("project: %s", p.path))
+		}
+		listTasks(p.configs, log.addIndent(), names, showArgs)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{
+		".gitignore": `# comment
+
+*.log
+!keep.log
+build/
+/dist
+docs/gen
+cache*/
+`,
+		"sub/.gitignore": "/out\n!/dist\n",
+	})
+	patterns, err := readIgnorePatterns(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ignorePattern{
+		{pattern: "*.log"},
+		{pattern: "keep.log", negate: true},
+		{pattern: "build", dirOnly: true},
+		{pattern: "dist", anchored: true},
+		{pattern: "docs/gen", anchored: true},
+		{pattern: "cache*", dirOnly: true},
+	}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Errorf("read patterns:\nwant %+v\ngot  %+v", want, patterns)
+	}
+	subPatterns, err := readIgnorePatterns(filepath.Join(dir, "sub"), "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns = append(patterns, subPatterns...)
+
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"x/y/a.log", false, true},
+		{"keep.log", false, false},
+		{"x/keep.log", false, false},
+		{"build", true, true},
+		{"x/build", true, true},
+		{"build", false, false},
+		{"dist", true, true},
+		{"x/dist", true, false},
+		{"docs/gen", true, true},
+		{"x/docs/gen", true, false},
+		{"cache", true, true},
+		{"x/cache2", true, true},
+		{"cache2", false, false},
+		{"sub/out", true, true},
+		{"out", true, false},
+		{"sub/x/out", true, false},
+		// negation in sub directory .gitignore overrides parent pattern
+		{"sub/dist", true, false},
+		{"src", true, false},
+	}
+	for _, c := range cases {
+		got := matchIgnorePatterns(patterns, c.path, c.isDir)
+		if got != c.ignored {
+			t.Errorf("match %s (dir: %v): want ignored %v, got %v", c.path, c.isDir, c.ignored, got)
+		}
+	}
+
+	patterns, err = readIgnorePatterns(filepath.Join(dir, "missing"), "missing")
+	if err != nil || patterns != nil {
+		t.Errorf("missing .gitignore: want no patterns, got %v, %v", patterns, err)
+	}
+}
+
+// newTestWorkspace creates workspace with projects in different directories, some of them are ignored.
+func newTestWorkspace(t *testing.T) *workspace {
+	dir := t.TempDir()
+	task := func(name string) string {
+		return "tasks:\n  " + name + ":\n    description: " + name + " task\n"
+	}
+	writeTestTree(t, dir, map[string]string{
+		"tash.yaml":                   task("build"),
+		".gitignore":                  "node_modules/\n",
+		"services/api/tash.yaml":      task("test"),
+		"services/web/tash.yml":       task("serve"),
+		"services/empty/tash.yaml":    "tasks: {}\n",
+		"node_modules/x/tash.yaml":    task("ignored"),
+		"vendor/y/tash.yaml":          task("excluded"),
+		".git/z/tash.yaml":            task("git"),
+		"tools/.gitignore":            "/gen\n",
+		"tools/gen/tash.yaml":         task("generated"),
+		"tools/lint/tash.yaml":        task("test"),
+		"tools/lint/nested/tash.yaml": task("nested"),
+	})
+	log := newLogger(false)
+	log.exit = func() {
+		t.Errorf("unexpected fatal error")
+	}
+	conf := filepath.Join(dir, "tash.yaml")
+	return newWorkspace(log, conf, loadConfiguration(log, dir, conf), []string{"vendor"})
+}
+
+func TestWorkspaceDiscover(t *testing.T) {
+	w := newTestWorkspace(t)
+	var paths []string
+	for _, p := range w.discover() {
+		paths = append(paths, p.path)
+	}
+	want := []string{"", "services/api", "services/empty", "services/web", "tools/lint", "tools/lint/nested"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("discover:\nwant %q\ngot  %q", want, paths)
+	}
+}
+
+func TestWorkspaceResolveTask(t *testing.T) {
+	w := newTestWorkspace(t)
+	cases := []struct {
+		address string
+		project string
+		name    string
+		found   bool
+	}{
+		{"build", "", "build", true},
+		{"services/api:test", "services/api", "test", true},
+		{"./services/api:test", "services/api", "test", true},
+		{"services/web:serve", "services/web", "serve", true},
+		{"tools/lint/nested:nested", "tools/lint/nested", "nested", true},
+		{"services/api:missing", "services/api", "missing", false},
+		{"services:test", "", "", false},
+		{"missing:test", "", "", false},
+		{":build", "", "", false},
+		{"test", "", "", false},
+	}
+	for _, c := range cases {
+		p, name, found := w.resolveTask(c.address)
+		if found != c.found {
+			t.Errorf("resolve %s: want found %v, got %v", c.address, c.found, found)
+		}
+		if c.project == "" && c.name == "" {
+			if p != nil {
+				t.Errorf("resolve %s: want no project, got %q", c.address, p.path)
+			}
+			continue
+		}
+		if p == nil || p.path != c.project || name != c.name {
+			t.Errorf("resolve %s: want %s %s, got %v %s", c.address, c.project, c.name, p, name)
+		}
+	}
+}
+
+// captureStdout returns the output written to stdout by fn.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, noColor := os.Stdout, color.NoColor
+	os.Stdout, color.NoColor = w, true
+	done := make(chan []byte)
+	go func() {
+		out, _ := ioutil.ReadAll(r)
+		done <- out
+	}()
+	defer func() {
+		os.Stdout, color.NoColor = stdout, noColor
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestWorkspaceListTasks(t *testing.T) {
+	w := newTestWorkspace(t)
+	cases := []struct {
+		names []string
+		all   bool
+		want  string
+	}{
+		{nil, false, `
+available tasks:
+    - build: build task
+`},
+		{nil, true, `
+project: .
+    available tasks:
+        - build: build task
+project: services/api
+    available tasks:
+        - test: test task
+project: services/web
+    available tasks:
+        - serve: serve task
+project: tools/lint
+    available tasks:
+        - test: test task
+project: tools/lint/nested
+    available tasks:
+        - nested: nested task
+`},
+		{[]string{"test"}, true, `
+project: services/api
+        - test: test task
+project: tools/lint
+        - test: test task
+`},
+		{[]string{"build", "nested"}, true, `
+project: .
+        - build: build task
+project: tools/lint/nested
+        - nested: nested task
+`},
+	}
+	for _, c := range cases {
+		got := captureStdout(t, func() {
+			w.listTasks(w.log, c.names, false, c.all)
+		})
+		want := strings.TrimPrefix(c.want, "\n")
+		if got != want {
+			t.Errorf("list %v (all: %v):\nwant:\n%s\ngot:\n%s", c.names, c.all, want, got)
+		}
+	}
+}